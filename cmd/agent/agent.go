@@ -5,15 +5,21 @@ import (
 
 	"github.com/camptocamp/bivac/cmd"
 	"github.com/camptocamp/bivac/internal/agent"
+	"github.com/camptocamp/bivac/internal/engine"
 )
 
 var (
-	targetURL    string
-	backupPath   string
-	hostname     string
-	force        bool
-	logReceiver  string
-	snapshotName string
+	targetURL      string
+	backupPath     string
+	hostname       string
+	force          bool
+	logReceiver    string
+	snapshotName   string
+	engineName     string
+	readDataSubset string
+	excludes       []string
+	includes       []string
+	tags           []string
 )
 
 var agentCmd = &cobra.Command{
@@ -22,9 +28,20 @@ var agentCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		switch args[0] {
 		case "backup":
-			agent.Backup(targetURL, backupPath, hostname, force, logReceiver)
+			agent.Backup(engineName, targetURL, backupPath, hostname, force, logReceiver, engine.BackupOptions{
+				Excludes: excludes,
+				Includes: includes,
+				Tags:     tags,
+			})
 		case "restore":
-			agent.Restore(targetURL, backupPath, hostname, force, logReceiver, snapshotName)
+			agent.Restore(engineName, targetURL, backupPath, hostname, force, logReceiver, snapshotName, engine.RestoreOptions{
+				Includes: includes,
+				Excludes: excludes,
+			})
+		case "check":
+			agent.Check(engineName, targetURL, readDataSubset, logReceiver)
+		case "prune":
+			agent.Prune(engineName, targetURL, logReceiver)
 		}
 	},
 }
@@ -36,5 +53,10 @@ func init() {
 	agentCmd.Flags().BoolVarP(&force, "force", "", false, "Force a backup by removing all locks.")
 	agentCmd.Flags().StringVarP(&logReceiver, "log.receiver", "", "", "Address where the manager will collect the logs.")
 	agentCmd.Flags().StringVarP(&snapshotName, "snapshot", "s", "latest", "Name of snapshot to restore")
+	agentCmd.Flags().StringVarP(&engineName, "engine", "", "restic", "Backup engine, restic or tar.")
+	agentCmd.Flags().StringVarP(&readDataSubset, "read-data-subset", "", "", "Subset of the data to read when checking the repository, e.g. 1/5 or 10%.")
+	agentCmd.Flags().StringArrayVarP(&excludes, "exclude", "", []string{}, "Pattern of the files to exclude from the backup or from the restore. Backup patterns starting with a slash are relative to the volume root.")
+	agentCmd.Flags().StringArrayVarP(&includes, "include", "", []string{}, "Pattern of the files to backup even if they are excluded, or path to restore.")
+	agentCmd.Flags().StringArrayVarP(&tags, "tag", "", []string{}, "Tag to set on the snapshot, formatted as key=value.")
 	cmd.RootCmd.AddCommand(agentCmd)
 }
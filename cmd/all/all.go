@@ -7,12 +7,20 @@ import (
 	_ "github.com/camptocamp/bivac/cmd/backup"
 	// Restore a volume
 	_ "github.com/camptocamp/bivac/cmd/restore"
+	// Show the backup and restore history of a volume
+	_ "github.com/camptocamp/bivac/cmd/history"
+	// Download a file or a directory from a snapshot of a volume
+	_ "github.com/camptocamp/bivac/cmd/dump"
 	// Get informations regarding the Bivac manager
 	_ "github.com/camptocamp/bivac/cmd/info"
+	// List the files of a snapshot of a volume
+	_ "github.com/camptocamp/bivac/cmd/ls"
 	// Run a Bivac manager
 	_ "github.com/camptocamp/bivac/cmd/manager"
 	// Run a custom Restic command on a volume's remote repository
 	_ "github.com/camptocamp/bivac/cmd/restic"
+	// List the snapshots of a volume
+	_ "github.com/camptocamp/bivac/cmd/snapshots"
 	// List volumes and display informations regarding the backed up volumes
 	_ "github.com/camptocamp/bivac/cmd/volumes"
 )
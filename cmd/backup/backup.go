@@ -3,6 +3,7 @@ package backup
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -10,12 +11,15 @@ import (
 
 	"github.com/camptocamp/bivac/cmd"
 	"github.com/camptocamp/bivac/pkg/client"
+	"github.com/camptocamp/bivac/pkg/volume"
 )
 
 var (
 	remoteAddress string
 	psk           string
 	force         bool
+	ignoreWindow  bool
+	wait          bool
 )
 
 var envs = make(map[string]string)
@@ -31,13 +35,29 @@ var backupCmd = &cobra.Command{
 			return
 		}
 
+		var jobs []volume.Job
 		for _, a := range args {
 			fmt.Printf("Backing up `%s'...\n", a)
-			err = c.BackupVolume(a, force)
+			job, err := c.BackupVolume(a, force, ignoreWindow)
 			if err != nil {
 				log.Errorf("failed to backup volume: %s", err)
 				return
 			}
+			fmt.Printf("Job `%s' submitted.\n", job.ID)
+			jobs = append(jobs, job)
+		}
+
+		if !wait {
+			return
+		}
+
+		for _, j := range jobs {
+			job, err := c.WaitJob(j.ID, 5*time.Second)
+			if err != nil {
+				log.Errorf("failed to wait for job `%s': %s", j.ID, err)
+				return
+			}
+			fmt.Printf("Job `%s' on `%s': %s %s\n", job.ID, job.VolumeID, job.Status, job.Error)
 		}
 
 		volumes, err := c.GetVolumes()
@@ -47,7 +67,8 @@ var backupCmd = &cobra.Command{
 		}
 
 		for _, a := range args {
-			for _, v := range volumes {
+			for i := range volumes {
+				v := &volumes[i]
 				if v.ID == a {
 					tbl, err := prettytable.NewTable([]prettytable.Column{
 						{},
@@ -88,6 +109,8 @@ func init() {
 	envs["BIVAC_SERVER_PSK"] = "server.psk"
 
 	backupCmd.Flags().BoolVarP(&force, "force", "", false, "Force backup by removing locks.")
+	backupCmd.Flags().BoolVarP(&ignoreWindow, "ignore-window", "", false, "Backup even outside of the volume's backup window or during a blackout period.")
+	backupCmd.Flags().BoolVarP(&wait, "wait", "", false, "Wait for the end of the backup.")
 
 	cmd.SetValuesFromEnv(envs, backupCmd.Flags())
 	cmd.RootCmd.AddCommand(backupCmd)
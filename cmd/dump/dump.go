@@ -0,0 +1,67 @@
+package dump
+
+import (
+	"io"
+	"os"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+
+	"github.com/camptocamp/bivac/cmd"
+	"github.com/camptocamp/bivac/pkg/client"
+)
+
+var (
+	remoteAddress string
+	psk           string
+	output        string
+)
+
+var envs = make(map[string]string)
+
+var dumpCmd = &cobra.Command{
+	Use:   "dump [VOLUME_ID] [SNAPSHOT_ID] [PATH]",
+	Short: "Download a file or a directory from a snapshot of a volume",
+	Long:  "Download the file PATH of a snapshot, or a tar archive of PATH if it is a directory. PATH is relative to the root of the volume and SNAPSHOT_ID can be latest.",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := client.NewClient(remoteAddress, psk)
+		if err != nil {
+			log.Errorf("failed to create new client: %s", err)
+			return
+		}
+
+		var w io.Writer = os.Stdout
+		if output != "" {
+			f, err := os.Create(output)
+			if err != nil {
+				log.Errorf("failed to create output file: %s", err)
+				return
+			}
+			defer f.Close()
+			w = f
+		}
+
+		err = c.DumpSnapshotFile(args[0], args[1], args[2], w)
+		if err != nil {
+			log.Errorf("failed to dump snapshot: %s", err)
+			if output != "" {
+				os.Remove(output)
+			}
+			return
+		}
+	},
+}
+
+func init() {
+	dumpCmd.Flags().StringVarP(&remoteAddress, "remote.address", "", "http://127.0.0.1:8182", "Address of the remote Bivac server.")
+	envs["BIVAC_REMOTE_ADDRESS"] = "remote.address"
+
+	dumpCmd.Flags().StringVarP(&psk, "server.psk", "", "", "Pre-shared key.")
+	envs["BIVAC_SERVER_PSK"] = "server.psk"
+
+	dumpCmd.Flags().StringVarP(&output, "output", "o", "", "Write to this file instead of the standard output.")
+
+	cmd.SetValuesFromEnv(envs, dumpCmd.Flags())
+	cmd.RootCmd.AddCommand(dumpCmd)
+}
@@ -0,0 +1,86 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/tatsushid/go-prettytable"
+
+	"github.com/camptocamp/bivac/cmd"
+	"github.com/camptocamp/bivac/pkg/client"
+)
+
+var (
+	remoteAddress string
+	psk           string
+)
+
+var envs = make(map[string]string)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [VOLUME_ID]",
+	Short: "Show the backup and restore history of a volume",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := client.NewClient(remoteAddress, psk)
+		if err != nil {
+			log.Errorf("failed to create new client: %s", err)
+			return
+		}
+
+		runs, err := c.GetRuns(args[0])
+		if err != nil {
+			log.Errorf("failed to get runs: %s", err)
+			return
+		}
+
+		tbl, err := prettytable.NewTable([]prettytable.Column{
+			{Header: "ID"},
+			{Header: "Type"},
+			{Header: "Trigger"},
+			{Header: "Status"},
+			{Header: "StartDate"},
+			{Header: "Duration"},
+			{Header: "Snapshot"},
+			{Header: "DataAdded"},
+			{Header: "ExitCodes"},
+			{Header: "Error"},
+		}...)
+		if err != nil {
+			log.Errorf("failed to format output: %s", err)
+			return
+		}
+		tbl.Separator = "\t"
+
+		for _, r := range runs {
+			var steps []string
+			for step, rc := range r.ExitCodes {
+				steps = append(steps, fmt.Sprintf("%s=%d", step, rc))
+			}
+			sort.Strings(steps)
+
+			dataAdded := ""
+			if r.Stats != nil {
+				dataAdded = units.BytesSize(float64(r.Stats.DataAdded))
+			}
+
+			tbl.AddRow(r.ID, r.Type, r.Trigger, r.Status, r.StartDate.Format("2006-01-02 15:04:05"), r.Duration.String(), r.SnapshotID, dataAdded, strings.Join(steps, ","), r.Error)
+		}
+		tbl.Print()
+	},
+}
+
+func init() {
+	historyCmd.Flags().StringVarP(&remoteAddress, "remote.address", "", "http://127.0.0.1:8182", "Address of the remote Bivac server.")
+	envs["BIVAC_REMOTE_ADDRESS"] = "remote.address"
+
+	historyCmd.Flags().StringVarP(&psk, "server.psk", "", "", "Pre-shared key.")
+	envs["BIVAC_SERVER_PSK"] = "server.psk"
+
+	cmd.SetValuesFromEnv(envs, historyCmd.Flags())
+	cmd.RootCmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,81 @@
+package ls
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/tatsushid/go-prettytable"
+
+	"github.com/camptocamp/bivac/cmd"
+	"github.com/camptocamp/bivac/pkg/client"
+)
+
+var (
+	remoteAddress string
+	psk           string
+)
+
+var envs = make(map[string]string)
+
+var lsCmd = &cobra.Command{
+	Use:   "ls [VOLUME_ID] [SNAPSHOT_ID] [PATH]",
+	Short: "List the files of a snapshot of a volume",
+	Long:  "List the files of a directory of a snapshot, PATH being relative to the root of the volume. SNAPSHOT_ID can be latest.",
+	Args:  cobra.RangeArgs(2, 3),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := client.NewClient(remoteAddress, psk)
+		if err != nil {
+			log.Errorf("failed to create new client: %s", err)
+			return
+		}
+
+		dir := "/"
+		if len(args) > 2 {
+			dir = args[2]
+		}
+
+		nodes, err := c.ListSnapshotFiles(args[0], args[1], dir)
+		if err != nil {
+			log.Errorf("failed to list snapshot: %s", err)
+			return
+		}
+
+		tbl, err := prettytable.NewTable([]prettytable.Column{
+			{Header: "Mode"},
+			{Header: "Size"},
+			{Header: "ModTime"},
+			{Header: "Path"},
+		}...)
+		if err != nil {
+			log.Errorf("failed to format output: %s", err)
+			return
+		}
+		tbl.Separator = "\t"
+
+		for _, n := range nodes {
+			size := ""
+			if n.Type == "file" {
+				size = units.BytesSize(float64(n.Size))
+			}
+			path := n.Path
+			if n.Type == "dir" {
+				path = fmt.Sprintf("%s/", n.Path)
+			}
+			tbl.AddRow(n.Mode.String(), size, n.ModTime.Format("2006-01-02 15:04:05"), path)
+		}
+		tbl.Print()
+	},
+}
+
+func init() {
+	lsCmd.Flags().StringVarP(&remoteAddress, "remote.address", "", "http://127.0.0.1:8182", "Address of the remote Bivac server.")
+	envs["BIVAC_REMOTE_ADDRESS"] = "remote.address"
+
+	lsCmd.Flags().StringVarP(&psk, "server.psk", "", "", "Pre-shared key.")
+	envs["BIVAC_SERVER_PSK"] = "server.psk"
+
+	cmd.SetValuesFromEnv(envs, lsCmd.Flags())
+	cmd.RootCmd.AddCommand(lsCmd)
+}
@@ -3,6 +3,7 @@ package manager
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -21,20 +22,13 @@ var (
 	// configuration from Cobra variables
 	Orchestrators manager.Orchestrators
 
-	dbPath           string
+	config manager.Config
+
 	resticForgetArgs string
 
-	providersFile       string
-	targetURL           string
-	retryCount          int
-	logServer           string
-	agentImage          string
 	whitelistVolumes    string
 	blacklistVolumes    string
 	whitelistAnnotation bool
-	parallelCount       int
-	refreshRate         string
-	backupInterval      string
 )
 var envs = make(map[string]string)
 
@@ -54,12 +48,12 @@ var managerCmd = &cobra.Command{
 			return
 		}
 
-		if agentImage == "" {
+		if config.AgentImage == "" {
 			managerVersion := bivacCmd.BuildInfo.Version
-			agentImage = fmt.Sprintf("ghcr.io/camptocamp/bivac:%s", utils.ComputeDockerAgentImage(managerVersion))
+			config.AgentImage = fmt.Sprintf("ghcr.io/camptocamp/bivac:%s", utils.ComputeDockerAgentImage(managerVersion))
 		}
 
-		err = manager.Start(bivacCmd.BuildInfo, o, server, volumesFilters, providersFile, targetURL, logServer, agentImage, retryCount, parallelCount, refreshRate, backupInterval)
+		err = manager.Start(bivacCmd.BuildInfo, o, server, volumesFilters, config)
 		if err != nil {
 			log.Errorf("failed to start manager: %s", err)
 			return
@@ -80,6 +74,10 @@ func init() {
 	envs["BIVAC_DOCKER_ENDPOINT"] = "docker.endpoint"
 	managerCmd.Flags().StringVarP(&Orchestrators.Docker.Network, "docker.network", "", "bridge", "Docker network.")
 	envs["BIVAC_DOCKER_NETWORK"] = "docker.network"
+	managerCmd.Flags().StringVarP(&Orchestrators.Docker.LockFile, "docker.lock-file", "", "/var/lib/bivac/manager.lock", "Lock file shared by the managers for leader election. The volume states are shared in a sibling file.")
+	envs["BIVAC_DOCKER_LOCK_FILE"] = "docker.lock-file"
+	managerCmd.Flags().StringVarP(&Orchestrators.Docker.CredentialsFile, "docker.credentials-file", "", "", "TOML file mapping volume names to the credentials of their repository, in [volumes.NAME] sections.")
+	envs["BIVAC_DOCKER_CREDENTIALS_FILE"] = "docker.credentials-file"
 
 	managerCmd.Flags().StringVarP(&Orchestrators.Cattle.URL, "cattle.url", "", "", "The Cattle URL.")
 	envs["CATTLE_URL"] = "cattle.url"
@@ -102,25 +100,40 @@ func init() {
 	envs["KUBERNETES_AGENT_LABELS"] = "kubernetes.agent-labels"
 	managerCmd.Flags().StringVarP(&Orchestrators.Kubernetes.AgentAnnotationsInline, "kubernetes.agent-annotations", "", "", "Additional annotations for agents.")
 	envs["KUBERNETES_AGENT_ANNOTATIONS"] = "kubernetes.agent-annotations"
+	managerCmd.Flags().DurationVarP(&Orchestrators.Kubernetes.AgentStartTimeout, "kubernetes.agent-start-timeout", "", 5*time.Minute, "Maximum time to wait for an agent pod to start.")
+	envs["KUBERNETES_AGENT_START_TIMEOUT"] = "kubernetes.agent-start-timeout"
+	managerCmd.Flags().StringVarP(&Orchestrators.Kubernetes.LeaseName, "kubernetes.lease-name", "", "bivac-manager", "Name of the Lease used for leader election.")
+	envs["KUBERNETES_LEASE_NAME"] = "kubernetes.lease-name"
+	managerCmd.Flags().StringVarP(&Orchestrators.Kubernetes.CredentialsSecret, "kubernetes.credentials-secret", "", "", "Name of the secret holding the repository credentials in the namespace of each volume. Can be overridden with the bivac.credentials-secret annotation.")
+	envs["KUBERNETES_CREDENTIALS_SECRET"] = "kubernetes.credentials-secret"
+
+	managerCmd.Flags().BoolVarP(&config.HA, "ha", "", false, "Run several managers in high availability. Only the elected leader schedules backups, the volume states are shared through the orchestrator.")
+	envs["BIVAC_HA"] = "ha"
+
+	managerCmd.Flags().StringVarP(&config.DBPath, "db.path", "", "", "Path to the database storing the manager state. The state is only kept in memory if empty.")
+	envs["BIVAC_DB_PATH"] = "db.path"
 
-	managerCmd.Flags().StringVarP(&resticForgetArgs, "restic.forget.args", "", "--group-by host --keep-daily 15 --prune", "Restic forget arguments.")
+	managerCmd.Flags().StringVarP(&resticForgetArgs, "restic.forget.args", "", "--group-by host --keep-daily 15", "Restic forget arguments. --prune is ignored unless prune.interval is 0s.")
 	envs["RESTIC_FORGET_ARGS"] = "restic.forget.args"
 
-	managerCmd.Flags().StringVarP(&providersFile, "providers.config", "", "/providers-config.default.toml", "Configuration file for providers.")
+	managerCmd.Flags().StringVarP(&config.ProvidersFile, "providers.config", "", "/providers-config.default.toml", "Configuration file for providers.")
 	envs["BIVAC_PROVIDERS_CONFIG"] = "providers.config"
 
-	managerCmd.Flags().StringVarP(&targetURL, "target.url", "r", "", "The target URL to push the backups to.")
+	managerCmd.Flags().StringVarP(&config.TargetURL, "target.url", "r", "", "The target URL to push the backups to.")
 	envs["BIVAC_TARGET_URL"] = "target.url"
 
-	managerCmd.Flags().IntVarP(&retryCount, "retry.count", "", 0, "Retry to backup the volume if something goes wrong with Bivac.")
+	managerCmd.Flags().IntVarP(&config.RetryCount, "retry.count", "", 0, "Retry to backup the volume if something goes wrong with Bivac.")
 	envs["BIVAC_RETRY_COUNT"] = "retry.count"
 
-	managerCmd.Flags().StringVarP(&logServer, "log.server", "", "", "Manager's API address that will receive logs from agents.")
+	managerCmd.Flags().StringVarP(&config.LogServer, "log.server", "", "", "Manager's API address that will receive logs from agents.")
 	envs["BIVAC_LOG_SERVER"] = "log.server"
 
-	managerCmd.Flags().StringVarP(&agentImage, "agent.image", "", "", "Agent's Docker image.")
+	managerCmd.Flags().StringVarP(&config.AgentImage, "agent.image", "", "", "Agent's Docker image.")
 	envs["BIVAC_AGENT_IMAGE"] = "agent.image"
 
+	managerCmd.Flags().StringVarP(&config.Engine, "engine", "", "restic", "Backup engine run by the agents, restic or tar. The tar engine stores compressed archives on a local path or on an HTTP file server with a rest: URL, which is not compatible with the restic REST server. Local paths are not supported on Kubernetes.")
+	envs["BIVAC_ENGINE"] = "engine"
+
 	managerCmd.Flags().StringVarP(&whitelistVolumes, "whitelist", "", "", "Whitelist volumes.")
 	envs["BIVAC_WHITELIST"] = "whitelist"
 	envs["BIVAC_VOLUMES_WHITELIST"] = "whitelist"
@@ -132,15 +145,57 @@ func init() {
 	managerCmd.Flags().BoolVarP(&whitelistAnnotation, "whitelist.annotations", "", false, "Require pvc whitelist annotation")
 	envs["BIVAC_WHITELIST_ANNOTATION"] = "whitelist.annotations"
 
-	managerCmd.Flags().IntVarP(&parallelCount, "parallel.count", "", 2, "The count of agents to run in parallel")
+	managerCmd.Flags().IntVarP(&config.ParallelCount, "parallel.count", "", 2, "The count of agents to run in parallel on a same host.")
 	envs["BIVAC_PARALLEL_COUNT"] = "parallel.count"
 
-	managerCmd.Flags().StringVarP(&refreshRate, "refresh.rate", "", "10m", "The volume list refresh rate.")
+	managerCmd.Flags().IntVarP(&config.ParallelPerTarget, "parallel.per-target", "", 0, "The maximum count of agents to run in parallel on a same target and namespace. 0 means unlimited.")
+	envs["BIVAC_PARALLEL_PER_TARGET"] = "parallel.per-target"
+
+	managerCmd.Flags().IntVarP(&config.ParallelTotal, "parallel.total", "", 0, "The maximum count of agents to run in parallel on all hosts. 0 means unlimited.")
+	envs["BIVAC_PARALLEL_TOTAL"] = "parallel.total"
+
+	managerCmd.Flags().StringVarP(&config.RefreshRate, "refresh.rate", "", "10m", "The volume list refresh rate.")
 	envs["BIVAC_REFRESH_RATE"] = "refresh.rate"
 
-	managerCmd.Flags().StringVarP(&backupInterval, "backup.interval", "", "23h", "Interval between two backups of a volume.")
+	managerCmd.Flags().StringVarP(&config.BackupInterval, "backup.interval", "", "23h", "Interval between two backups of a volume without `bivac.schedule` label or annotation.")
 	envs["BIVAC_BACKUP_INTERVAL"] = "backup.interval"
 
+	managerCmd.Flags().StringVarP(&config.BackupTimeout, "backup.timeout", "", "1h", "Maximum duration of a backup of a volume without `bivac.timeout` label or annotation.")
+	envs["BIVAC_BACKUP_TIMEOUT"] = "backup.timeout"
+
+	managerCmd.Flags().StringVarP(&config.BackupSpread, "backup.spread", "", "0s", "Window over which the backups due at startup are spread. Each volume gets a fixed offset in this window.")
+	envs["BIVAC_BACKUP_SPREAD"] = "backup.spread"
+
+	managerCmd.Flags().StringVarP(&config.BackupWindow, "backup.window", "", "", "Comma separated list of daily periods during which scheduled backups can run, e.g. 22:00-06:00 Europe/Zurich. Can be overridden with the bivac.window label or annotation.")
+	envs["BIVAC_BACKUP_WINDOW"] = "backup.window"
+
+	managerCmd.Flags().StringVarP(&config.Blackout, "backup.blackout", "", "", "Comma separated list of daily periods during which no backup can run, in addition to the bivac.blackout label or annotation.")
+	envs["BIVAC_BACKUP_BLACKOUT"] = "backup.blackout"
+
+	managerCmd.Flags().StringVarP(&config.BackupExclude, "backup.exclude", "", "/lost+found", "Comma separated list of patterns of the files to exclude from the backups. Patterns starting with a slash are relative to the volume root. Extended with the bivac.exclude label or annotation and the .bivacignore file of the volume.")
+	envs["BIVAC_BACKUP_EXCLUDE"] = "backup.exclude"
+
+	managerCmd.Flags().StringVarP(&config.BackupInclude, "backup.include", "", "", "Comma separated list of patterns of the files to backup even if they are excluded. Extended with the bivac.include label or annotation.")
+	envs["BIVAC_BACKUP_INCLUDE"] = "backup.include"
+
+	managerCmd.Flags().StringVarP(&config.CheckInterval, "check.interval", "", "0s", "Interval between two integrity checks of a repository. 0s disables the checks.")
+	envs["BIVAC_CHECK_INTERVAL"] = "check.interval"
+
+	managerCmd.Flags().StringVarP(&config.CheckReadDataSubset, "check.read-data-subset", "", "", "Subset of the data to read when checking a repository, e.g. 1/5 or 10%. Only the metadata are checked if empty.")
+	envs["BIVAC_CHECK_READ_DATA_SUBSET"] = "check.read-data-subset"
+
+	managerCmd.Flags().StringVarP(&config.PruneInterval, "prune.interval", "", "168h", "Interval between two prunes of a repository. Backups only forget the old snapshots, the unreferenced data are removed by the prunes. 0s disables the prunes.")
+	envs["BIVAC_PRUNE_INTERVAL"] = "prune.interval"
+
+	managerCmd.Flags().StringVarP(&config.PruneTimeout, "prune.timeout", "", "6h", "Maximum duration of a prune.")
+	envs["BIVAC_PRUNE_TIMEOUT"] = "prune.timeout"
+
+	managerCmd.Flags().IntVarP(&config.PruneParallelCount, "prune.parallel-count", "", 1, "The maximum count of prunes to run in parallel.")
+	envs["BIVAC_PRUNE_PARALLEL_COUNT"] = "prune.parallel-count"
+
+	managerCmd.Flags().StringVarP(&config.GracePeriod, "shutdown.grace-period", "", "5m", "Maximum time to wait for the running agents when the manager is stopped.")
+	envs["BIVAC_SHUTDOWN_GRACE_PERIOD"] = "shutdown.grace-period"
+
 	bivacCmd.SetValuesFromEnv(envs, managerCmd.Flags())
 	bivacCmd.RootCmd.AddCommand(managerCmd)
 }
@@ -2,9 +2,12 @@ package restore
 
 import (
 	"fmt"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/camptocamp/bivac/cmd"
 	"github.com/camptocamp/bivac/pkg/client"
+	"github.com/camptocamp/bivac/pkg/volume"
 	"github.com/spf13/cobra"
 	"github.com/tatsushid/go-prettytable"
 )
@@ -14,6 +17,9 @@ var (
 	psk           string
 	remoteAddress string
 	snapshotName  string
+	wait          bool
+	includes      []string
+	excludes      []string
 )
 
 var envs = make(map[string]string)
@@ -28,13 +34,37 @@ var restoreCmd = &cobra.Command{
 			log.Errorf("failed to create new client: %s", err)
 			return
 		}
+		var jobs []volume.Job
 		for _, a := range args {
 			fmt.Printf("Restoring `%s'...\n", a)
-			err = c.RestoreVolume(a, force, snapshotName)
+			job, err := c.RestoreVolume(a, force, snapshotName, includes, excludes)
 			if err != nil {
 				log.Errorf("failed to restore volume: %s", err)
 				return
 			}
+			fmt.Printf("Job `%s' submitted.\n", job.ID)
+			jobs = append(jobs, job)
+		}
+		if !wait {
+			return
+		}
+		for _, j := range jobs {
+			job, err := c.WaitJob(j.ID, 5*time.Second)
+			if err != nil {
+				log.Errorf(
+					"failed to wait for job `%s': %s",
+					j.ID,
+					err,
+				)
+				return
+			}
+			fmt.Printf(
+				"Job `%s' on `%s': %s %s\n",
+				job.ID,
+				job.VolumeID,
+				job.Status,
+				job.Error,
+			)
 		}
 		volumes, err := c.GetVolumes()
 		if err != nil {
@@ -42,7 +72,8 @@ var restoreCmd = &cobra.Command{
 			return
 		}
 		for _, a := range args {
-			for _, v := range volumes {
+			for i := range volumes {
+				v := &volumes[i]
 				if v.ID == a {
 					tbl, err := prettytable.NewTable(
 						[]prettytable.Column{
@@ -117,6 +148,27 @@ func init() {
 		"latest",
 		"Name of snapshot to restore",
 	)
+	restoreCmd.Flags().StringArrayVarP(
+		&includes,
+		"include",
+		"",
+		[]string{},
+		"Path to restore, relative to the volume root. Can be repeated, the whole volume is restored if not set.",
+	)
+	restoreCmd.Flags().StringArrayVarP(
+		&excludes,
+		"exclude",
+		"",
+		[]string{},
+		"Path not to restore, relative to the volume root. Can be repeated.",
+	)
+	restoreCmd.Flags().BoolVarP(
+		&wait,
+		"wait",
+		"",
+		false,
+		"Wait for the end of the restore.",
+	)
 	cmd.SetValuesFromEnv(envs, restoreCmd.Flags())
 	cmd.RootCmd.AddCommand(restoreCmd)
 }
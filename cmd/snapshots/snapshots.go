@@ -0,0 +1,74 @@
+package snapshots
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tatsushid/go-prettytable"
+
+	"github.com/camptocamp/bivac/cmd"
+	"github.com/camptocamp/bivac/pkg/client"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+var (
+	remoteAddress string
+	psk           string
+	tags          []string
+)
+
+var envs = make(map[string]string)
+
+var snapshotsCmd = &cobra.Command{
+	Use:   "snapshots [VOLUME_ID]",
+	Short: "List the snapshots of a volume",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		c, err := client.NewClient(remoteAddress, psk)
+		if err != nil {
+			log.Errorf("failed to create new client: %s", err)
+			return
+		}
+
+		snapshots, err := c.GetSnapshots(args[0], tags)
+		if err != nil {
+			log.Errorf("failed to get snapshots: %s", err)
+			return
+		}
+
+		tbl, err := prettytable.NewTable([]prettytable.Column{
+			{Header: "ID"},
+			{Header: "Time"},
+			{Header: "Host"},
+			{Header: "Trigger"},
+			{Header: "Version"},
+			{Header: "Paths"},
+		}...)
+		if err != nil {
+			log.Errorf("failed to format output: %s", err)
+			return
+		}
+		tbl.Separator = "\t"
+
+		for _, s := range snapshots {
+			trigger, _ := s.GetTag(volume.TagTrigger)
+			version, _ := s.GetTag(volume.TagBivacVersion)
+			tbl.AddRow(s.ShortID, s.Time.Format("2006-01-02 15:04:05"), s.Hostname, trigger, version, strings.Join(s.Paths, ","))
+		}
+		tbl.Print()
+	},
+}
+
+func init() {
+	snapshotsCmd.Flags().StringVarP(&remoteAddress, "remote.address", "", "http://127.0.0.1:8182", "Address of the remote Bivac server.")
+	envs["BIVAC_REMOTE_ADDRESS"] = "remote.address"
+
+	snapshotsCmd.Flags().StringVarP(&psk, "server.psk", "", "", "Pre-shared key.")
+	envs["BIVAC_SERVER_PSK"] = "server.psk"
+
+	snapshotsCmd.Flags().StringArrayVarP(&tags, "tag", "", []string{}, "Only list the snapshots having this tag, formatted as key=value. Can be repeated.")
+
+	cmd.SetValuesFromEnv(envs, snapshotsCmd.Flags())
+	cmd.RootCmd.AddCommand(snapshotsCmd)
+}
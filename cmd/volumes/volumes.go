@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
 	"github.com/spf13/cobra"
 	"github.com/tatsushid/go-prettytable"
 
@@ -44,6 +45,7 @@ var volumesCmd = &cobra.Command{
 				{Header: "Mountpoint"},
 				{Header: "LastBackupDate"},
 				{Header: "LastBackupStatus"},
+				{Header: "NextBackupDate"},
 				{Header: "Backing up"},
 			}...)
 			if err != nil {
@@ -52,8 +54,9 @@ var volumesCmd = &cobra.Command{
 			}
 			tbl.Separator = "\t"
 
-			for _, v := range volumes {
-				tbl.AddRow(v.ID, v.Name, v.Hostname, v.Mountpoint, v.LastBackupDate, v.LastBackupStatus, strconv.FormatBool(v.BackingUp))
+			for i := range volumes {
+				v := &volumes[i]
+				tbl.AddRow(v.ID, v.Name, v.Hostname, v.Mountpoint, v.LastBackupDate, v.LastBackupStatus, v.NextBackupDate, strconv.FormatBool(v.BackingUp))
 			}
 
 			tbl.Print()
@@ -61,7 +64,8 @@ var volumesCmd = &cobra.Command{
 		}
 
 		for _, a := range args {
-			for _, v := range volumes {
+			for i := range volumes {
+				v := &volumes[i]
 				if v.ID == a {
 					tbl, err := prettytable.NewTable([]prettytable.Column{
 						{},
@@ -83,11 +87,64 @@ var volumesCmd = &cobra.Command{
 					fmt.Printf("Mountpoint: %s\n", v.Mountpoint)
 					fmt.Printf("Backup date: %s\n", v.LastBackupDate)
 					fmt.Printf("Backup status: %s\n", v.LastBackupStatus)
+					if s := v.LastBackupStats; s != nil {
+						fmt.Printf("Last backup:\n")
+						fmt.Printf("\tSnapshot: %s\n", s.SnapshotID)
+						fmt.Printf("\tFiles: %d new, %d changed, %d unmodified\n", s.FilesNew, s.FilesChanged, s.FilesUnmodified)
+						fmt.Printf("\tData added: %s\n", units.BytesSize(float64(s.DataAdded)))
+						fmt.Printf("\tData processed: %s\n", units.BytesSize(float64(s.TotalBytesProcessed)))
+						fmt.Printf("\tDuration: %s\n", s.Duration)
+					}
+					if v.LastFailureKind != "" {
+						fmt.Printf("Failure: %s (%d consecutive)\n", v.LastFailureKind, v.ConsecutiveFailures)
+					}
+					if v.Schedule != "" {
+						fmt.Printf("Schedule: %s\n", v.Schedule)
+					}
+					if v.BackupWindow != "" {
+						fmt.Printf("Backup window: %s\n", v.BackupWindow)
+					}
+					if v.Blackout != "" {
+						fmt.Printf("Blackout: %s\n", v.Blackout)
+					}
+					if v.BackupTimeout != "" {
+						fmt.Printf("Backup timeout: %s\n", v.BackupTimeout)
+					}
+					if len(v.Excludes) > 0 {
+						fmt.Printf("Excludes: %s\n", strings.Join(v.Excludes, ", "))
+					}
+					if len(v.Includes) > 0 {
+						fmt.Printf("Includes: %s\n", strings.Join(v.Includes, ", "))
+					}
+					if v.Retention != nil {
+						fmt.Printf("Retention policy: %s (%s)\n", strings.Join(v.Retention.Args(), " "), v.Retention.Source)
+					}
+					fmt.Printf("Next backup date: %s\n", v.NextBackupDate)
+					if v.LastCheckDate != "" {
+						fmt.Printf("Check date: %s\n", v.LastCheckDate)
+						fmt.Printf("Check status: %s\n", v.LastCheckStatus)
+					}
+					if v.NextCheckDate != "" {
+						fmt.Printf("Next check date: %s\n", v.NextCheckDate)
+					}
+					if v.LastPruneDate != "" {
+						fmt.Printf("Prune date: %s\n", v.LastPruneDate)
+						fmt.Printf("Prune status: %s\n", v.LastPruneStatus)
+					}
+					if v.NextPruneDate != "" {
+						fmt.Printf("Next prune date: %s\n", v.NextPruneDate)
+					}
 					fmt.Printf("Logs:\n")
 					tbl.AddRow("", "testInit", strings.Replace(v.Logs["testInit"], "\n", "\n\t\t\t", -1))
 					tbl.AddRow("", "init", strings.Replace(v.Logs["init"], "\n", "\n\t\t\t", -1))
 					tbl.AddRow("", "backup", strings.Replace(v.Logs["backup"], "\n", "\n\t\t\t", -1))
 					tbl.AddRow("", "forget", strings.Replace(v.Logs["forget"], "\n", "\n\t\t\t", -1))
+					if v.Logs["check"] != "" {
+						tbl.AddRow("", "check", strings.Replace(v.Logs["check"], "\n", "\n\t\t\t", -1))
+					}
+					if v.Logs["prune"] != "" {
+						tbl.AddRow("", "prune", strings.Replace(v.Logs["prune"], "\n", "\n\t\t\t", -1))
+					}
 					tbl.Print()
 				}
 			}
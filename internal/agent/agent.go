@@ -14,89 +14,84 @@ import (
 	"github.com/camptocamp/bivac/internal/utils"
 )
 
-// Backup runs Restic commands to backup a volume
-func Backup(targetURL, backupPath, hostname string, force bool, logReceiver string) {
-	e := &engine.Engine{
-		DefaultArgs: []string{
-			"--no-cache",
-			"--json",
-			"-r",
-			targetURL,
-		},
-		Output: make(map[string]utils.OutputFormat),
+// Backup runs the backup engine to backup a volume
+func Backup(engineName, targetURL, backupPath, hostname string, force bool, logReceiver string, opts engine.BackupOptions) {
+	var output string
+	e, err := engine.NewEngine(engineName, targetURL)
+	if err != nil {
+		output = utils.ReturnError(fmt.Errorf("failed to get engine: %s", err))
+	} else {
+		output = e.Backup(backupPath, hostname, force, opts)
 	}
 
-	output := e.Backup(backupPath, hostname, force)
-
-	if logReceiver != "" {
-		data := `{"data":` + output + `}`
-		req, err := http.NewRequest("POST", logReceiver, bytes.NewBuffer([]byte(data)))
-		if err != nil {
-			log.Errorf("failed to build new request: %s\n", err)
-			return
-		}
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("Authorization", "Bearer "+os.Getenv("BIVAC_SERVER_PSK"))
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Errorf("failed to send data: %s\n", err)
-			return
-		}
-		defer resp.Body.Close()
-
-		b, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Errorf("failed to read body: %s\n", err)
-			return
-		}
-		if resp.StatusCode != 200 {
-			log.Infof("Response from API: %s", b)
-			return
-		}
-		return
-	}
-
-	fmt.Println(base64.StdEncoding.EncodeToString([]byte(output)))
+	sendOutput(output, logReceiver)
 	return
 }
 
-// Restore runs Restic commands to restore backed up data to a new volume
+// Restore runs the backup engine to restore backed up data to a new volume
 func Restore(
+	engineName,
 	targetURL,
 	backupPath,
 	hostname string,
 	force bool,
 	logReceiver string,
 	snapshotName string,
+	opts engine.RestoreOptions,
 ) {
-	e := &engine.Engine{
-		DefaultArgs: []string{
-			"--no-cache",
-			"--json",
-			"-r",
-			targetURL,
-		},
-		Output: make(map[string]utils.OutputFormat),
+	var output string
+	e, err := engine.NewEngine(engineName, targetURL)
+	if err != nil {
+		output = utils.ReturnError(fmt.Errorf("failed to get engine: %s", err))
+	} else {
+		output = e.Restore(backupPath, hostname, force, snapshotName, opts)
 	}
-	output := e.Restore(backupPath, hostname, force, snapshotName)
+
+	sendOutput(output, logReceiver)
+	return
+}
+
+// Check runs the backup engine to verify the integrity of a repository
+func Check(engineName, targetURL, readDataSubset, logReceiver string) {
+	var output string
+	e, err := engine.NewEngine(engineName, targetURL)
+	if err != nil {
+		output = utils.ReturnError(fmt.Errorf("failed to get engine: %s", err))
+	} else {
+		output = e.Check(readDataSubset)
+	}
+
+	sendOutput(output, logReceiver)
+	return
+}
+
+// Prune runs the backup engine to remove the unreferenced data of a repository
+func Prune(engineName, targetURL, logReceiver string) {
+	var output string
+	e, err := engine.NewEngine(engineName, targetURL)
+	if err != nil {
+		output = utils.ReturnError(fmt.Errorf("failed to get engine: %s", err))
+	} else {
+		output = e.Prune()
+	}
+
+	sendOutput(output, logReceiver)
+	return
+}
+
+// sendOutput sends the engine output to the manager's log receiver
+// or prints it encoded in base64 if there is no log receiver.
+func sendOutput(output, logReceiver string) {
 	if logReceiver != "" {
 		data := `{"data":` + output + `}`
-		req, err := http.NewRequest(
-			"POST",
-			logReceiver,
-			bytes.NewBuffer([]byte(data)),
-		)
+		req, err := http.NewRequest("POST", logReceiver, bytes.NewBuffer([]byte(data)))
 		if err != nil {
 			log.Errorf("failed to build new request: %s\n", err)
 			return
 		}
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set(
-			"Authorization",
-			"Bearer "+os.Getenv("BIVAC_SERVER_PSK"),
-		)
+		req.Header.Set("Authorization", "Bearer "+os.Getenv("BIVAC_SERVER_PSK"))
+
 		client := &http.Client{}
 		resp, err := client.Do(req)
 		if err != nil {
@@ -104,6 +99,7 @@ func Restore(
 			return
 		}
 		defer resp.Body.Close()
+
 		b, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
 			log.Errorf("failed to read body: %s\n", err)
@@ -111,6 +107,7 @@ func Restore(
 		}
 		if resp.StatusCode != 200 {
 			log.Infof("Response from API: %s", b)
+			return
 		}
 		return
 	}
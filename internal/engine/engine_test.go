@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// GetVolumeSnapshot
+func TestGetVolumeSnapshot(t *testing.T) {
+	// Output of `restic snapshots --json`
+	var snapshot Snapshot
+	err := json.Unmarshal([]byte(`{"time":"2020-01-01T10:00:00Z","paths":["/data"],"hostname":"foo","id":"abcdef123456","short_id":"abcdef12","tags":["volume_id=foo"]}`), &snapshot)
+	assert.Nil(t, err)
+
+	assert.Equal(t, snapshot.GetVolumeSnapshot(), volume.Snapshot{
+		ID:       "abcdef123456",
+		ShortID:  "abcdef12",
+		Time:     time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		Hostname: "foo",
+		Paths:    []string{"/data"},
+		Tags:     []string{"volume_id=foo"},
+	})
+}
+
+// ParseBackupSummary
+func TestParseBackupSummary(t *testing.T) {
+	givenOutput := `{"message_type":"status","percent_done":0.5}
+{"message_type":"summary","files_new":2,"files_changed":1,"files_unmodified":5,"data_added":1024,"total_bytes_processed":4096,"total_duration":1.5,"snapshot_id":"a1b2c3d4"}
+`
+
+	summary, err := ParseBackupSummary(givenOutput)
+	assert.Nil(t, err)
+	assert.Equal(t, summary.SnapshotID, "a1b2c3d4")
+	assert.Equal(t, summary.GetStats(), &volume.BackupStats{
+		SnapshotID:          "a1b2c3d4",
+		FilesNew:            2,
+		FilesChanged:        1,
+		FilesUnmodified:     5,
+		DataAdded:           1024,
+		TotalBytesProcessed: 4096,
+		Duration:            1500 * time.Millisecond,
+	})
+
+	_, err = ParseBackupSummary("Fatal: unable to open repository")
+	assert.NotNil(t, err)
+}
+
+// filterStatusMessages
+func TestFilterStatusMessages(t *testing.T) {
+	givenOutput := `{"message_type":"status","percent_done":0.5}
+Fatal: unable to save snapshot
+{"message_type":"summary","snapshot_id":"a1b2c3d4"}`
+
+	assert.Equal(t, string(filterStatusMessages([]byte(givenOutput))), `Fatal: unable to save snapshot
+{"message_type":"summary","snapshot_id":"a1b2c3d4"}`)
+}
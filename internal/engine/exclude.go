@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreFile is an optional file at the root of a volume listing patterns to exclude, one per line
+const ignoreFile = ".bivacignore"
+
+// BackupOptions are the options of a backup
+type BackupOptions struct {
+	// Excludes are the patterns of the files to exclude from the backup.
+	// Patterns starting with a slash are relative to the root of the volume, other patterns match at any depth.
+	// Excluding a directory excludes its content, use `dir/*` to include some of its files back.
+	Excludes []string
+	// Includes are the patterns of the files to back up even if they match an exclude pattern
+	Includes []string
+	// Tags are set on the snapshot, see volume.FormatTag
+	Tags []string
+}
+
+// getExcludePatterns returns the exclude patterns of a backup, in order of precedence:
+// the excludes, the patterns of the ignore file and the includes, as negated patterns.
+func getExcludePatterns(backupPath string, opts BackupOptions) (patterns []string, err error) {
+	patterns = append(patterns, opts.Excludes...)
+
+	f, err := os.Open(filepath.Join(backupPath, ignoreFile))
+	if os.IsNotExist(err) {
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("failed to open %s: %s", ignoreFile, err)
+		return
+	} else {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			patterns = append(patterns, line)
+		}
+		err = scanner.Err()
+		if err != nil {
+			err = fmt.Errorf("failed to read %s: %s", ignoreFile, err)
+			return
+		}
+	}
+
+	for _, include := range opts.Includes {
+		patterns = append(patterns, "!"+include)
+	}
+	return
+}
+
+// isExcluded returns true if the path rel, relative to the root of the volume, matches the patterns
+// The last matching pattern wins, negated patterns include the path back.
+func isExcluded(patterns []string, rel string) (excluded bool) {
+	components := strings.Split(filepath.ToSlash(rel), "/")
+	for _, p := range patterns {
+		negated := strings.HasPrefix(p, "!")
+		p = strings.TrimPrefix(p, "!")
+
+		if matchPattern(p, components) {
+			excluded = !negated
+		}
+	}
+	return
+}
+
+// matchPattern returns true if a pattern matches the components of a path, as restic does:
+// patterns starting with a slash match from the root of the volume, other patterns match at any depth,
+// and a pattern matching a directory also matches its content.
+func matchPattern(pattern string, components []string) bool {
+	anchored := strings.HasPrefix(pattern, "/")
+	patterns := strings.Split(strings.Trim(pattern, "/"), "/")
+	for offset := 0; offset < len(components); offset++ {
+		if matchComponents(patterns, components[offset:]) {
+			return true
+		}
+		if anchored {
+			break
+		}
+	}
+	return false
+}
+
+// matchComponents returns true if the patterns match the first components of a path
+// `**` matches any count of components.
+func matchComponents(patterns, components []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(components); i++ {
+			if matchComponents(patterns[1:], components[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(components) == 0 {
+		return false
+	}
+	if matched, _ := path.Match(patterns[0], components[0]); !matched {
+		return false
+	}
+	return matchComponents(patterns[1:], components[1:])
+}
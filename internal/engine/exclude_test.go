@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// getExcludePatterns
+func TestGetExcludePatterns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac-volume")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	opts := BackupOptions{
+		Excludes: []string{"/lost+found"},
+		Includes: []string{"keep.tmp"},
+	}
+
+	patterns, err := getExcludePatterns(dir, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, patterns, []string{"/lost+found", "!keep.tmp"})
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, ignoreFile), []byte("# caches\n*.tmp\n\n/cache\n"), 0644))
+	patterns, err = getExcludePatterns(dir, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, patterns, []string{"/lost+found", "*.tmp", "/cache", "!keep.tmp"})
+}
+
+// excludePatterns and excludeTests are shared by the engines so that they exclude the same files
+var excludePatterns = []string{"/lost+found", "*.tmp", "/cache/*", "!/cache/keep", "!keep.tmp", "logs/old", "**/secret"}
+
+var excludeTests = []struct {
+	path     string
+	excluded bool
+}{
+	{"lost+found", true},
+	{"data/lost+found", false},
+	{"data/foo.tmp", true},
+	{"data/keep.tmp", false},
+	{"cache", false},
+	{"cache/foo", true},
+	{"cache/keep", false},
+	{"cache/keep/bar", false},
+	{"data/cache/foo", false},
+	{"logs/old", true},
+	{"app/logs/old", true},
+	{"app/logs/old/bar", true},
+	{"app/logs/new", false},
+	{"a/b/secret", true},
+	{"data/foo", false},
+}
+
+// isExcluded
+func TestIsExcluded(t *testing.T) {
+	for _, tt := range excludeTests {
+		assert.Equal(t, isExcluded(excludePatterns, tt.path), tt.excluded, tt.path)
+	}
+}
+
+func TestResticExcludes(t *testing.T) {
+	if _, err := exec.LookPath("restic"); err != nil {
+		t.Skip("restic is not installed")
+	}
+
+	dir, err := ioutil.TempDir("", "bivac-restic")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "volume")
+	repo := filepath.Join(dir, "repo")
+
+	for _, tt := range excludeTests {
+		isDir := false
+		for _, other := range excludeTests {
+			if strings.HasPrefix(other.path, tt.path+"/") {
+				isDir = true
+			}
+		}
+		name := filepath.Join(root, tt.path)
+		if isDir {
+			assert.Nil(t, os.MkdirAll(name, 0755))
+		} else {
+			assert.Nil(t, os.MkdirAll(filepath.Dir(name), 0755))
+			assert.Nil(t, ioutil.WriteFile(name, []byte("foo"), 0644))
+		}
+	}
+
+	excludeFile, err := writeExcludeFile(root, excludePatterns)
+	assert.Nil(t, err)
+	defer os.Remove(excludeFile)
+
+	restic := func(args ...string) string {
+		cmd := exec.Command("restic", append([]string{"--repo", repo}, args...)...)
+		cmd.Env = append(os.Environ(), "RESTIC_PASSWORD=bivac")
+		output, err := cmd.CombinedOutput()
+		assert.Nil(t, err, string(output))
+		return string(output)
+	}
+	restic("init")
+	restic("backup", "--exclude-file", excludeFile, root)
+
+	backedUp := make(map[string]bool)
+	for _, line := range strings.Split(restic("ls", "latest"), "\n") {
+		backedUp[strings.TrimSpace(line)] = true
+	}
+	for _, tt := range excludeTests {
+		assert.Equal(t, !backedUp[filepath.Join(root, tt.path)], tt.excluded, tt.path)
+	}
+}
+
+// writeExcludeFile
+func TestWriteExcludeFile(t *testing.T) {
+	name, err := writeExcludeFile("/var/lib/docker/volumes/foo/_data/", []string{"/lost+found", "*.tmp", "!/keep.tmp"})
+	assert.Nil(t, err)
+	defer os.Remove(name)
+
+	b, err := ioutil.ReadFile(name)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "/var/lib/docker/volumes/foo/_data/lost+found\n*.tmp\n!/var/lib/docker/volumes/foo/_data/keep.tmp\n")
+}
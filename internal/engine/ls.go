@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// Node is a file of a snapshot, as printed by `restic ls --json`
+type Node struct {
+	Name       string      `json:"name"`
+	Type       string      `json:"type"`
+	Path       string      `json:"path"`
+	Size       uint64      `json:"size"`
+	Mode       os.FileMode `json:"mode"`
+	ModTime    time.Time   `json:"mtime"`
+	StructType string      `json:"struct_type"`
+}
+
+// GetVolumeNode converts the node into the node returned by the API
+func (n Node) GetVolumeNode() volume.Node {
+	return volume.Node{
+		Name:    n.Name,
+		Type:    n.Type,
+		Path:    n.Path,
+		Size:    n.Size,
+		Mode:    n.Mode,
+		ModTime: n.ModTime,
+	}
+}
+
+// cleanSnapshotPath returns p as an absolute path relative to the root of the volume
+func cleanSnapshotPath(p string) string {
+	return path.Clean("/" + p)
+}
+
+// relativeNodePath returns the path of a node relative to root, the path of the volume in the snapshot
+func relativeNodePath(root, p string) string {
+	root = path.Clean(root)
+	if root == "/" {
+		return cleanSnapshotPath(p)
+	}
+	return cleanSnapshotPath(strings.TrimPrefix(path.Clean(p), root))
+}
+
+// filterNodes returns the content of the directory dir, or the node of dir if it is a file
+// The paths of the nodes must be relative to the root of the volume.
+func filterNodes(nodes []Node, dir string) (filtered []Node) {
+	dir = cleanSnapshotPath(dir)
+
+	filtered = []Node{}
+	for _, n := range nodes {
+		if n.Path == dir && n.Type != "dir" {
+			return []Node{n}
+		}
+		if n.Path != "/" && path.Dir(n.Path) == dir {
+			filtered = append(filtered, n)
+		}
+	}
+	return
+}
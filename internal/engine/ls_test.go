@@ -0,0 +1,30 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// relativeNodePath
+func TestRelativeNodePath(t *testing.T) {
+	assert.Equal(t, relativeNodePath("/var/lib/docker/volumes/foo/_data", "/var/lib/docker/volumes/foo/_data"), "/")
+	assert.Equal(t, relativeNodePath("/var/lib/docker/volumes/foo/_data/", "/var/lib/docker/volumes/foo/_data/bar"), "/bar")
+	assert.Equal(t, relativeNodePath("/", "/bar/baz"), "/bar/baz")
+}
+
+// filterNodes
+func TestFilterNodes(t *testing.T) {
+	nodes := []Node{
+		{Name: "data", Type: "dir", Path: "/data"},
+		{Name: "foo", Type: "file", Path: "/data/foo"},
+		{Name: "baz", Type: "dir", Path: "/data/baz"},
+		{Name: "qux", Type: "file", Path: "/data/baz/qux"},
+		{Name: "bar", Type: "file", Path: "/bar"},
+	}
+
+	assert.Equal(t, filterNodes(nodes, "/"), []Node{nodes[0], nodes[4]})
+	assert.Equal(t, filterNodes(nodes, "data/"), []Node{nodes[1], nodes[2]})
+	assert.Equal(t, filterNodes(nodes, "/data/foo"), []Node{nodes[1]})
+	assert.Equal(t, filterNodes(nodes, "/missing"), []Node{})
+}
@@ -0,0 +1,633 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/camptocamp/bivac/internal/utils"
+)
+
+// ResticEngine stores informations to use Restic backup engine
+type ResticEngine struct {
+	DefaultArgs []string
+	Output      map[string]utils.OutputFormat
+	// Env is the environment of the restic commands, e.g. with the repository credentials.
+	// The commands use the environment of the current process if nil.
+	Env []string
+}
+
+// NewResticEngine returns a Restic engine working on the repository targetURL
+func NewResticEngine(targetURL string) *ResticEngine {
+	return &ResticEngine{
+		DefaultArgs: []string{
+			"--no-cache",
+			"--json",
+			"-r",
+			targetURL,
+		},
+		Output: make(map[string]utils.OutputFormat),
+	}
+}
+
+// command returns a restic command run with the engine's environment
+func (r *ResticEngine) command(args ...string) *exec.Cmd {
+	cmd := exec.Command("restic", args...)
+	cmd.Env = r.Env
+	return cmd
+}
+
+// GetName returns the engine name
+func (*ResticEngine) GetName() string {
+	return "restic"
+}
+
+// Backup performs the backup of the passed volume
+func (r *ResticEngine) Backup(backupPath, hostname string, force bool, opts BackupOptions) string {
+	var err error
+
+	err = r.initializeRepository()
+	if err != nil {
+		return utils.ReturnFormattedOutput(r.Output)
+	}
+
+	if force {
+		err = r.unlockRepository()
+		if err != nil {
+			return utils.ReturnFormattedOutput(r.Output)
+		}
+	}
+
+	err = r.backupVolume(hostname, backupPath, opts)
+	if err != nil {
+		return utils.ReturnFormattedOutput(r.Output)
+	}
+
+	// A backup lock may remains. As forget does not prune, the lock is short-lived.
+	for i := 0; i < 3; i++ {
+		err = r.Forget()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Second)
+	}
+	if err != nil {
+		return utils.ReturnFormattedOutput(r.Output)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = r.retrieveBackupsStats()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Second)
+	}
+
+	r.retrieveRepositoryStats()
+
+	return utils.ReturnFormattedOutput(r.Output)
+}
+
+// Restore performs the restore of the passed volume
+func (r *ResticEngine) Restore(
+	backupPath,
+	hostname string,
+	force bool,
+	snapshotName string,
+	opts RestoreOptions,
+) string {
+	var err error
+	if force {
+		err = r.unlockRepository()
+		if err != nil {
+			return utils.ReturnFormattedOutput(r.Output)
+		}
+	}
+	err = r.restoreVolume(hostname, backupPath, snapshotName, opts)
+	if err != nil {
+		return utils.ReturnFormattedOutput(r.Output)
+	}
+	for i := 0; i < 3; i++ {
+		err = r.retrieveBackupsStats()
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Second)
+	}
+	if err != nil {
+		return utils.ReturnFormattedOutput(r.Output)
+	}
+	return utils.ReturnFormattedOutput(r.Output)
+}
+
+func (r *ResticEngine) initializeRepository() (err error) {
+	rc := 0
+
+	// Check if the remote repository exists
+	output, err := r.command(append(r.DefaultArgs, "snapshots")...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	if rc == 0 {
+		return
+	}
+	r.Output["testInit"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	err = nil
+
+	rc = 0
+	// Create remote repository
+	output, err = r.command(append(r.DefaultArgs, "init")...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["init"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	fmt.Printf("init: %s\n", output)
+	return
+}
+
+func (r *ResticEngine) backupVolume(hostname, backupPath string, opts BackupOptions) (err error) {
+	rc := 0
+	var output []byte
+	defer func() {
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+			if rc == 0 {
+				rc = 1
+			}
+		}
+		output = filterStatusMessages(output)
+		r.Output["backup"] = utils.OutputFormat{
+			Stdout:   base64.StdEncoding.EncodeToString(output),
+			ExitCode: rc,
+		}
+		fmt.Printf("backup: %s\n", output)
+	}()
+
+	cmd := append(r.DefaultArgs, []string{"--host", hostname, "backup", backupPath}...)
+	for _, tag := range opts.Tags {
+		cmd = append(cmd, "--tag", tag)
+	}
+
+	patterns, err := getExcludePatterns(backupPath, opts)
+	if err != nil {
+		output = []byte(err.Error())
+		return
+	}
+	if len(patterns) > 0 {
+		var excludeFile string
+		excludeFile, err = writeExcludeFile(backupPath, patterns)
+		if err != nil {
+			output = []byte(err.Error())
+			return
+		}
+		defer os.Remove(excludeFile)
+		cmd = append(cmd, "--exclude-file", excludeFile)
+	}
+
+	output, err = r.command(cmd...).CombinedOutput()
+	return
+}
+
+// writeExcludeFile writes exclude patterns in a temporary file read by restic
+// Patterns relative to the root of the volume are anchored to backupPath.
+func writeExcludeFile(backupPath string, patterns []string) (name string, err error) {
+	f, err := ioutil.TempFile("", "bivac-exclude")
+	if err != nil {
+		err = fmt.Errorf("failed to create exclude file: %s", err)
+		return
+	}
+	defer f.Close()
+	name = f.Name()
+
+	root := strings.TrimSuffix(backupPath, "/")
+	for _, p := range patterns {
+		negation := ""
+		if strings.HasPrefix(p, "!") {
+			negation = "!"
+			p = strings.TrimPrefix(p, "!")
+		}
+		if strings.HasPrefix(p, "/") {
+			p = root + p
+		}
+		_, err = fmt.Fprintln(f, negation+p)
+		if err != nil {
+			err = fmt.Errorf("failed to write exclude file: %s", err)
+			return
+		}
+	}
+	return
+}
+
+// Forget removes the snapshots according to the retention policy set in RESTIC_FORGET_ARGS
+// The repository is only pruned if --prune is set, the manager removes it when prunes are scheduled.
+func (r *ResticEngine) Forget() (err error) {
+	rc := 0
+	cmd := append(r.DefaultArgs, "forget")
+	cmd = append(cmd, strings.Fields(os.Getenv("RESTIC_FORGET_ARGS"))...)
+
+	output, err := r.command(cmd...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["forget"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	fmt.Printf("forget: %s\n", output)
+	return
+}
+
+func (r *ResticEngine) restoreVolume(
+	hostname,
+	backupPath string,
+	snapshotName string,
+	opts RestoreOptions,
+) (err error) {
+	rc := 0
+	origionalBackupPath := r.getOrigionalBackupPath(
+		hostname,
+		backupPath,
+		snapshotName,
+	)
+	workingPath, err := utils.GetRandomFilePath(backupPath)
+	workingPath = strings.ReplaceAll(workingPath, "//", "/")
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	err = os.MkdirAll(workingPath, 0700)
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	output, err := r.command(
+		append(
+			append(
+				r.DefaultArgs,
+				[]string{
+					"restore",
+					snapshotName,
+					"--target",
+					workingPath,
+				}...,
+			),
+			getResticRestoreArgs(origionalBackupPath, opts)...,
+		)...,
+	).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+		if rc == 0 {
+			rc = 1
+		}
+		r.failRestore(workingPath, output, rc)
+		err = fmt.Errorf("failed to restore snapshot: %s", err)
+		return
+	}
+	restoreDumpPath := workingPath + origionalBackupPath
+	if _, err = os.Stat(restoreDumpPath); os.IsNotExist(err) && len(opts.Includes) > 0 {
+		err = fmt.Errorf("no matching paths in snapshot")
+		r.failRestore(workingPath, append(output, []byte(err.Error()+"\n")...), 1)
+		return
+	}
+	if len(opts.Includes) > 0 && len(opts.Excludes) > 0 {
+		err = removeExcludedPaths(restoreDumpPath, opts.Excludes)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+	}
+	files, err := ioutil.ReadDir(restoreDumpPath)
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	collisionName := ""
+	for _, f := range files {
+		fileName := f.Name()
+		restoreSubPath := strings.ReplaceAll(backupPath+"/"+fileName, "//", "/")
+		if restoreSubPath == workingPath {
+			collisionName, err = utils.GetRandomFileName(workingPath)
+			if err != nil {
+				rc = utils.HandleExitCode(err)
+			}
+			restoreSubPath = strings.ReplaceAll(workingPath+"/"+collisionName, "//", "/")
+		}
+		err = utils.MergePaths(
+			strings.ReplaceAll(restoreDumpPath+"/"+fileName, "//", "/"),
+			restoreSubPath,
+		)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+		err = os.RemoveAll(
+			strings.ReplaceAll(restoreDumpPath+"/"+fileName, "//", "/"),
+		)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+	}
+	if len(collisionName) > 0 {
+		tmpWorkingPath, err := utils.GetRandomFilePath(backupPath)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+		err = os.Rename(
+			workingPath,
+			tmpWorkingPath,
+		)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+		err = os.Rename(
+			strings.ReplaceAll(tmpWorkingPath+"/"+collisionName, "//", "/"),
+			workingPath,
+		)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+		err = os.RemoveAll(tmpWorkingPath)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+	} else {
+		err = os.RemoveAll(workingPath)
+		if err != nil {
+			rc = utils.HandleExitCode(err)
+		}
+	}
+	r.Output["restore"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	err = nil
+	return
+}
+
+// failRestore records a failed restore and removes its working directory, the volume is left untouched
+func (r *ResticEngine) failRestore(workingPath string, output []byte, rc int) {
+	os.RemoveAll(workingPath)
+	r.Output["restore"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+}
+
+func (r *ResticEngine) getOrigionalBackupPath(
+	hostname,
+	backupPath string,
+	snapshotName string,
+) string {
+	output, err := r.command(
+		append(
+			r.DefaultArgs,
+			[]string{"ls", snapshotName}...,
+		)...,
+	).CombinedOutput()
+	if err != nil {
+		return err.Error()
+	}
+	type Header struct {
+		Paths []string `json:"paths"`
+	}
+	headerJSON := []byte("{\"paths\": [\"\"]")
+	jsons := strings.Split(string(output), "\n")
+	for i := 0; i < len(jsons); i++ {
+		if strings.Index(jsons[i], "\",\"paths\":[\"") > -1 {
+			headerJSON = []byte(jsons[i])
+			break
+		}
+	}
+	var header Header
+	err = json.Unmarshal(headerJSON, &header)
+	if err != nil {
+		return ""
+	}
+	return header.Paths[0]
+}
+
+func (r *ResticEngine) retrieveBackupsStats() (err error) {
+	rc := 0
+	output, err := r.command(append(r.DefaultArgs, []string{"snapshots"}...)...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["snapshots"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	fmt.Printf("snapshots: %s\n", output)
+
+	return
+}
+
+// retrieveRepositoryStats records the repository size
+// It is only informative, a failure is not recorded to avoid failing the backup.
+func (r *ResticEngine) retrieveRepositoryStats() {
+	stats, err := r.Stats()
+	if err != nil {
+		fmt.Printf("stats: %s\n", err)
+		return
+	}
+
+	b, _ := json.Marshal(stats)
+	r.Output["stats"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(b),
+		ExitCode: 0,
+	}
+	return
+}
+
+func (r *ResticEngine) unlockRepository() (err error) {
+	rc := 0
+	output, err := r.command(append(r.DefaultArgs, []string{"unlock", "--remove-all"}...)...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["unlock"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	fmt.Printf("unlock: %s\n", output)
+	err = nil
+	return
+}
+
+// Snapshots returns the snapshots of the repository, the oldest first
+func (r *ResticEngine) Snapshots() (snapshots []Snapshot, err error) {
+	output, err := r.command(append(r.DefaultArgs, []string{"snapshots"}...)...).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("failed to list snapshots: %s: %s", err, output)
+		return
+	}
+
+	err = json.Unmarshal(output, &snapshots)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal snapshots: %s", err)
+	}
+	return
+}
+
+// getSnapshot returns the latest snapshot or the snapshot matching an ID or a short ID
+func (r *ResticEngine) getSnapshot(snapshotName string) (snapshot Snapshot, err error) {
+	output, err := r.command(append(r.DefaultArgs, "snapshots", snapshotName)...).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("failed to get snapshot: %s: %s", err, output)
+		return
+	}
+
+	var snapshots []Snapshot
+	err = json.Unmarshal(output, &snapshots)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal snapshots: %s", err)
+		return
+	}
+	if len(snapshots) != 1 || len(snapshots[0].Path) == 0 {
+		err = fmt.Errorf("snapshot `%s' not found", snapshotName)
+		return
+	}
+	snapshot = snapshots[0]
+	return
+}
+
+// Ls returns the content of the directory dir of a snapshot, dir being relative to the root of the volume
+func (r *ResticEngine) Ls(snapshotName, dir string) (nodes []Node, err error) {
+	snapshot, err := r.getSnapshot(snapshotName)
+	if err != nil {
+		return
+	}
+	root := snapshot.Path[0]
+
+	output, err := r.command(append(r.DefaultArgs, "ls", snapshot.ID, path.Join(root, cleanSnapshotPath(dir)))...).Output()
+	if err != nil {
+		err = fmt.Errorf("failed to list snapshot: %s", err)
+		return
+	}
+
+	var all []Node
+	for _, line := range strings.Split(string(output), "\n") {
+		var n Node
+		if json.Unmarshal([]byte(line), &n) != nil || n.StructType != "node" {
+			continue
+		}
+		n.Path = relativeNodePath(root, n.Path)
+		all = append(all, n)
+	}
+	nodes = filterNodes(all, dir)
+	return
+}
+
+// Dump writes the file p of a snapshot to w, or a tar archive of p if it is a directory
+// p is relative to the root of the volume. The dump is stopped when ctx is done.
+func (r *ResticEngine) Dump(ctx context.Context, snapshotName, p string, w io.Writer) (err error) {
+	snapshot, err := r.getSnapshot(snapshotName)
+	if err != nil {
+		return
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "restic", append(r.DefaultArgs, "dump", snapshot.ID, path.Join(snapshot.Path[0], cleanSnapshotPath(p)))...)
+	cmd.Env = r.Env
+	cmd.Stdout = w
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("failed to dump snapshot: %s: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return
+}
+
+// Check verifies the integrity of the repository
+// A subset of the data is also read if readDataSubset is set, e.g. `1/5` or `10%`.
+func (r *ResticEngine) Check(readDataSubset string) string {
+	rc := 0
+	cmd := append(r.DefaultArgs, "check")
+	if readDataSubset != "" {
+		cmd = append(cmd, "--read-data-subset", readDataSubset)
+	}
+
+	output, err := r.command(cmd...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["check"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	fmt.Printf("check: %s\n", output)
+	return utils.ReturnFormattedOutput(r.Output)
+}
+
+// Prune removes the data which are no longer referenced by any snapshot
+func (r *ResticEngine) Prune() string {
+	rc := 0
+	output, err := r.command(append(r.DefaultArgs, "prune")...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["prune"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	fmt.Printf("prune: %s\n", output)
+
+	if rc == 0 {
+		r.retrieveRepositoryStats()
+	}
+	return utils.ReturnFormattedOutput(r.Output)
+}
+
+// Stats returns the size of the repository
+func (r *ResticEngine) Stats() (stats Stats, err error) {
+	output, err := r.command(append(r.DefaultArgs, []string{"stats", "--mode", "raw-data"}...)...).CombinedOutput()
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve repository stats: %s: %s", err, output)
+		return
+	}
+
+	err = json.Unmarshal(output, &stats)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal repository stats: %s", err)
+	}
+	return
+}
+
+// RawCommand runs a custom Restic command locally
+func (r *ResticEngine) RawCommand(cmd []string) (err error) {
+	rc := 0
+	output, err := r.command(append(r.DefaultArgs, cmd...)...).CombinedOutput()
+	if err != nil {
+		rc = utils.HandleExitCode(err)
+	}
+	r.Output["raw"] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+	return
+}
+
+// filterStatusMessages removes the progress messages from the output of `restic backup --json`
+// Errors and the summary message are kept.
+func filterStatusMessages(output []byte) []byte {
+	var filtered []string
+	for _, line := range strings.Split(string(output), "\n") {
+		var msg struct {
+			MessageType string `json:"message_type"`
+		}
+		if json.Unmarshal([]byte(line), &msg) == nil && msg.MessageType == "status" {
+			continue
+		}
+		filtered = append(filtered, line)
+	}
+	return []byte(strings.Join(filtered, "\n"))
+}
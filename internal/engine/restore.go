@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// RestoreOptions are the options of a restore
+// Paths are relative to the root of the volume and may contain wildcards, see path.Match.
+// Selecting a directory selects its whole content.
+type RestoreOptions struct {
+	// Includes are the paths to restore, the whole snapshot is restored if empty
+	Includes []string
+	// Excludes are the paths not to restore, even if they are included
+	Excludes []string
+}
+
+// isRestored returns true if the path rel, relative to the root of the volume, is selected by the options
+func (opts RestoreOptions) isRestored(rel string) bool {
+	if len(opts.Includes) > 0 && !matchPaths(opts.Includes, rel) {
+		return false
+	}
+	return !matchPaths(opts.Excludes, rel)
+}
+
+// matchPaths returns true if the path rel or one of its parent directories matches one of the patterns
+func matchPaths(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		p = cleanSnapshotPath(p)
+		for cur := cleanSnapshotPath(filepath.ToSlash(rel)); ; cur = path.Dir(cur) {
+			if matched, _ := path.Match(p, cur); matched {
+				return true
+			}
+			if cur == "/" {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// getResticRestoreArgs returns the arguments of `restic restore` selecting the paths to restore
+// root is the path of the volume in the snapshot. Restic cannot combine includes and excludes,
+// the excludes are then removed after the restore by removeExcludedPaths.
+func getResticRestoreArgs(root string, opts RestoreOptions) (args []string) {
+	for _, p := range opts.Includes {
+		args = append(args, "--include", path.Join(root, cleanSnapshotPath(p)))
+	}
+	if len(opts.Includes) > 0 {
+		return
+	}
+	for _, p := range opts.Excludes {
+		args = append(args, "--exclude", path.Join(root, cleanSnapshotPath(p)))
+	}
+	return
+}
+
+// removeExcludedPaths removes the paths of the restored directory root matching the excludes
+func removeExcludedPaths(root string, excludes []string) (err error) {
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." || !matchPaths(excludes, rel) {
+			return err
+		}
+
+		err = os.RemoveAll(p)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to remove excluded paths: %s", err)
+	}
+	return
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// isRestored
+func TestIsRestored(t *testing.T) {
+	opts := RestoreOptions{}
+	assert.True(t, opts.isRestored("data/foo"))
+
+	opts = RestoreOptions{
+		Includes: []string{"/data", "*.conf"},
+		Excludes: []string{"data/cache"},
+	}
+	assert.True(t, opts.isRestored("data"))
+	assert.True(t, opts.isRestored("data/foo"))
+	assert.True(t, opts.isRestored("app.conf"))
+	assert.False(t, opts.isRestored("data/cache"))
+	assert.False(t, opts.isRestored("data/cache/foo"))
+	assert.False(t, opts.isRestored("bar"))
+	assert.False(t, opts.isRestored("etc/app.conf"))
+}
+
+// getResticRestoreArgs
+func TestGetResticRestoreArgs(t *testing.T) {
+	root := "/var/lib/docker/volumes/foo/_data"
+
+	args := getResticRestoreArgs(root, RestoreOptions{})
+	assert.Nil(t, args)
+
+	args = getResticRestoreArgs(root, RestoreOptions{
+		Excludes: []string{"data/cache"},
+	})
+	assert.Equal(t, args, []string{"--exclude", root + "/data/cache"})
+
+	args = getResticRestoreArgs(root, RestoreOptions{
+		Includes: []string{"/data", "etc/*.conf"},
+		Excludes: []string{"data/cache"},
+	})
+	assert.Equal(t, args, []string{"--include", root + "/data", "--include", root + "/etc/*.conf"})
+}
+
+// removeExcludedPaths
+func TestRemoveExcludedPaths(t *testing.T) {
+	dir := newTestVolume(t)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, removeExcludedPaths(dir, []string{"/data"}))
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), 1)
+	assert.Equal(t, files[0].Name(), "bar")
+	_, err = os.Stat(filepath.Join(dir, "bar"))
+	assert.Nil(t, err)
+}
+
+// fakeRestic lists a snapshot of /data and fails or restores nothing, depending on FAKE_RESTIC_RESTORE
+const fakeRestic = `#!/bin/sh
+for arg in "$@"; do
+	case "$arg" in
+	ls)
+		echo '{"time":"2020-01-01T10:00:00Z","paths":["/data"],"struct_type":"snapshot"}'
+		exit 0
+		;;
+	restore)
+		if [ "$FAKE_RESTIC_RESTORE" = "fail" ]; then
+			echo "Fatal: unable to open repository" >&2
+			exit 3
+		fi
+		exit 0
+		;;
+	esac
+done
+`
+
+// restoreVolume
+func TestResticEngineRestoreFailure(t *testing.T) {
+	bin, err := ioutil.TempDir("", "bivac-bin")
+	assert.Nil(t, err)
+	defer os.RemoveAll(bin)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(bin, "restic"), []byte(fakeRestic), 0755))
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	defer os.Unsetenv("FAKE_RESTIC_RESTORE")
+
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	r := NewResticEngine("/repo")
+
+	os.Setenv("FAKE_RESTIC_RESTORE", "fail")
+	err = r.restoreVolume("foo", volume, "latest", RestoreOptions{})
+	assert.NotNil(t, err)
+	assert.Equal(t, r.Output["restore"].ExitCode, 3)
+	stdout, _ := base64.StdEncoding.DecodeString(r.Output["restore"].Stdout)
+	assert.True(t, strings.Contains(string(stdout), "unable to open repository"))
+
+	// The includes match nothing
+	os.Setenv("FAKE_RESTIC_RESTORE", "")
+	err = r.restoreVolume("foo", volume, "latest", RestoreOptions{Includes: []string{"/missing"}})
+	assert.NotNil(t, err)
+	assert.Equal(t, r.Output["restore"].ExitCode, 1)
+	stdout, _ = base64.StdEncoding.DecodeString(r.Output["restore"].Stdout)
+	assert.Equal(t, string(stdout), "no matching paths in snapshot\n")
+
+	// The volume is left untouched
+	files, err := ioutil.ReadDir(volume)
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), 2)
+}
@@ -0,0 +1,163 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// retentionPolicy is the subset of `restic forget` policies supported by the tar engine
+type retentionPolicy struct {
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+// parseRetentionPolicy reads the --keep-* options of `restic forget` arguments
+// Other options are ignored.
+func parseRetentionPolicy(args string) (p retentionPolicy, err error) {
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		var dst *int
+		kv := strings.SplitN(fields[i], "=", 2)
+		switch kv[0] {
+		case "--keep-last":
+			dst = &p.Last
+		case "--keep-daily":
+			dst = &p.Daily
+		case "--keep-weekly":
+			dst = &p.Weekly
+		case "--keep-monthly":
+			dst = &p.Monthly
+		case "--keep-yearly":
+			dst = &p.Yearly
+		default:
+			continue
+		}
+
+		value := ""
+		if len(kv) == 2 {
+			value = kv[1]
+		} else if i+1 < len(fields) {
+			i++
+			value = fields[i]
+		}
+		*dst, err = strconv.Atoi(value)
+		if err != nil {
+			err = fmt.Errorf("invalid value for %s: `%s'", kv[0], value)
+			return
+		}
+	}
+	return
+}
+
+// ParseRetentionPolicy returns the retention policy set by `restic forget` arguments
+func ParseRetentionPolicy(args string) (policy volume.RetentionPolicy, err error) {
+	p, err := parseRetentionPolicy(args)
+	if err != nil {
+		return
+	}
+
+	policy = volume.RetentionPolicy{
+		Last:    p.Last,
+		Daily:   p.Daily,
+		Weekly:  p.Weekly,
+		Monthly: p.Monthly,
+		Yearly:  p.Yearly,
+	}
+	return
+}
+
+// retentionPolicyOptions are the `restic forget` options set by a retention policy
+var retentionPolicyOptions = map[string]bool{
+	"--keep-last":    true,
+	"--keep-daily":   true,
+	"--keep-weekly":  true,
+	"--keep-monthly": true,
+	"--keep-yearly":  true,
+}
+
+// OverrideRetentionArgs replaces the options of `restic forget` arguments set by a retention policy by the ones of the policy
+// Other options, e.g. --keep-within, --keep-tag or --prune, are kept.
+func OverrideRetentionArgs(args string, policy volume.RetentionPolicy) string {
+	var kept []string
+	fields := strings.Fields(args)
+	for i := 0; i < len(fields); i++ {
+		kv := strings.SplitN(fields[i], "=", 2)
+		if !retentionPolicyOptions[kv[0]] {
+			kept = append(kept, fields[i])
+			continue
+		}
+		if len(kv) == 1 && i+1 < len(fields) {
+			i++
+		}
+	}
+	return strings.Join(append(kept, policy.Args()...), " ")
+}
+
+// RemovePruneArg returns the `restic forget` arguments without --prune
+func RemovePruneArg(args string) string {
+	var kept []string
+	for _, f := range strings.Fields(args) {
+		if f != "--prune" {
+			kept = append(kept, f)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func (p retentionPolicy) isEmpty() bool {
+	return p == retentionPolicy{}
+}
+
+// apply splits snapshots into the ones to keep and the ones to remove, as `restic forget` does:
+// the newest snapshot of each of the last N days, weeks, months and years is kept.
+func (p retentionPolicy) apply(snapshots []Snapshot) (keep, remove []Snapshot) {
+	if p.isEmpty() {
+		return snapshots, nil
+	}
+
+	sorted := make([]Snapshot, len(snapshots))
+	copy(sorted, snapshots)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Time.After(sorted[j].Time)
+	})
+
+	buckets := []struct {
+		count  int
+		period func(s Snapshot) string
+		last   string
+	}{
+		{p.Daily, func(s Snapshot) string { return s.Time.Format("2006-01-02") }, ""},
+		{p.Weekly, func(s Snapshot) string {
+			year, week := s.Time.ISOWeek()
+			return fmt.Sprintf("%d-%d", year, week)
+		}, ""},
+		{p.Monthly, func(s Snapshot) string { return s.Time.Format("2006-01") }, ""},
+		{p.Yearly, func(s Snapshot) string { return s.Time.Format("2006") }, ""},
+	}
+
+	for i, s := range sorted {
+		kept := i < p.Last
+		for b := range buckets {
+			period := buckets[b].period(s)
+			if buckets[b].count > 0 && period != buckets[b].last {
+				buckets[b].last = period
+				buckets[b].count--
+				kept = true
+			}
+		}
+
+		if kept {
+			keep = append(keep, s)
+		} else {
+			remove = append(remove, s)
+		}
+	}
+	return
+}
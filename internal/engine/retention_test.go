@@ -0,0 +1,63 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// parseRetentionPolicy
+func TestParseRetentionPolicy(t *testing.T) {
+	p, err := parseRetentionPolicy("--group-by host --keep-daily 15 --keep-last=3 --prune")
+	assert.Nil(t, err)
+	assert.Equal(t, p, retentionPolicy{Last: 3, Daily: 15})
+
+	_, err = parseRetentionPolicy("--keep-daily foo")
+	assert.NotNil(t, err)
+}
+
+// OverrideRetentionArgs
+func TestOverrideRetentionArgs(t *testing.T) {
+	policy := volume.RetentionPolicy{Daily: 7, Weekly: 4}
+
+	args := OverrideRetentionArgs("--group-by host --keep-daily 15 --keep-last=3 --keep-within 2d --keep-tag=keep --keep-hourly 24 --prune", policy)
+	assert.Equal(t, args, "--group-by host --keep-within 2d --keep-tag=keep --keep-hourly 24 --prune --keep-daily 7 --keep-weekly 4")
+	args = OverrideRetentionArgs("", policy)
+	assert.Equal(t, args, "--keep-daily 7 --keep-weekly 4")
+}
+
+// RemovePruneArg
+func TestRemovePruneArg(t *testing.T) {
+	assert.Equal(t, RemovePruneArg("--group-by host --prune --keep-daily 15"), "--group-by host --keep-daily 15")
+	assert.Equal(t, RemovePruneArg(""), "")
+}
+
+// apply
+func TestRetentionPolicyApply(t *testing.T) {
+	date := time.Date(2020, 1, 31, 12, 0, 0, 0, time.UTC)
+	var snapshots []Snapshot
+	for i := 0; i < 10; i++ {
+		// Two snapshots a day
+		snapshots = append(snapshots, Snapshot{
+			ID:   string(rune('a' + i)),
+			Time: date.Add(time.Duration(-12*i) * time.Hour),
+		})
+	}
+
+	keep, remove := retentionPolicy{}.apply(snapshots)
+	assert.Equal(t, len(keep), 10)
+	assert.Equal(t, len(remove), 0)
+
+	keep, remove = retentionPolicy{Last: 1, Daily: 3}.apply(snapshots)
+	assert.Equal(t, len(keep), 3)
+	assert.Equal(t, keep[0].ID, "a")
+	assert.Equal(t, keep[1].ID, "c")
+	assert.Equal(t, keep[2].ID, "e")
+	assert.Equal(t, len(remove), 7)
+
+	keep, _ = retentionPolicy{Last: 2, Monthly: 1}.apply(snapshots)
+	assert.Equal(t, len(keep), 2)
+}
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// archiveStorage stores the files of the tar engine
+type archiveStorage interface {
+	List() (names []string, err error)
+	Put(name string, r io.Reader) error
+	Get(name string) (io.ReadCloser, error)
+	Delete(name string) error
+}
+
+// newArchiveStorage returns the storage matching targetURL:
+// a `rest:` prefixed HTTP URL or a local path, optionally prefixed with `file://` or `local:`
+func newArchiveStorage(targetURL string) (s archiveStorage, err error) {
+	switch {
+	case strings.HasPrefix(targetURL, "rest:"):
+		s = &restStorage{
+			url:    strings.TrimSuffix(strings.TrimPrefix(targetURL, "rest:"), "/"),
+			client: &http.Client{},
+		}
+	case strings.HasPrefix(targetURL, "file://"):
+		s = &fsStorage{dir: strings.TrimPrefix(targetURL, "file://")}
+	case strings.HasPrefix(targetURL, "local:"):
+		s = &fsStorage{dir: strings.TrimPrefix(targetURL, "local:")}
+	case strings.Contains(targetURL, ":"):
+		err = fmt.Errorf("unsupported target URL `%s'", targetURL)
+	default:
+		s = &fsStorage{dir: targetURL}
+	}
+	return
+}
+
+// IsLocalTarget returns true if the target URL is a path on the filesystem of the agents
+func IsLocalTarget(targetURL string) bool {
+	return strings.HasPrefix(targetURL, "file://") || strings.HasPrefix(targetURL, "local:") || !strings.Contains(targetURL, ":")
+}
+
+// fsStorage stores files in a local directory
+type fsStorage struct {
+	dir string
+}
+
+func (s *fsStorage) List() (names []string, err error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to list files: %s", err)
+		return
+	}
+
+	for _, f := range files {
+		if !f.IsDir() {
+			names = append(names, f.Name())
+		}
+	}
+	return
+}
+
+func (s *fsStorage) Put(name string, r io.Reader) (err error) {
+	err = os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create directory: %s", err)
+		return
+	}
+
+	// Files are written under a temporary name so that they never appear incomplete
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		err = fmt.Errorf("failed to create file: %s", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		err = fmt.Errorf("failed to write file: %s", err)
+		return
+	}
+	err = tmp.Close()
+	if err != nil {
+		err = fmt.Errorf("failed to write file: %s", err)
+		return
+	}
+
+	err = os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+	if err != nil {
+		err = fmt.Errorf("failed to rename file: %s", err)
+	}
+	return
+}
+
+func (s *fsStorage) Get(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.dir, name))
+}
+
+func (s *fsStorage) Delete(name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// restStorage stores files on an HTTP endpoint.
+// `GET <url>/` returns the JSON list of the file names,
+// files are managed with PUT, GET and DELETE requests on `<url>/<name>`.
+// It is not compatible with the restic REST server, whose API is specific to restic repositories.
+type restStorage struct {
+	url    string
+	client *http.Client
+}
+
+func (s *restStorage) do(method, name string, body io.Reader) (resp *http.Response, err error) {
+	req, err := http.NewRequest(method, s.url+"/"+name, body)
+	if err != nil {
+		err = fmt.Errorf("failed to build request: %s", err)
+		return
+	}
+
+	resp, err = s.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to send request: %s", err)
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		err = fmt.Errorf("%s %s: unexpected status: %s", method, s.url+"/"+name, resp.Status)
+	}
+	return
+}
+
+func (s *restStorage) List() (names []string, err error) {
+	resp, err := s.do("GET", "", nil)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	err = json.NewDecoder(resp.Body).Decode(&names)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal file list: %s", err)
+	}
+	return
+}
+
+func (s *restStorage) Put(name string, r io.Reader) (err error) {
+	resp, err := s.do("PUT", name, r)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
+
+func (s *restStorage) Get(name string) (io.ReadCloser, error) {
+	resp, err := s.do("GET", name, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *restStorage) Delete(name string) (err error) {
+	resp, err := s.do("DELETE", name, nil)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+	return
+}
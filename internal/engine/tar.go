@@ -0,0 +1,938 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	mrand "math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/camptocamp/bivac/internal/utils"
+)
+
+const (
+	archiveExt  = ".tar.gz"
+	manifestExt = ".json"
+)
+
+// TarEngine stores each snapshot as a compressed tar archive, on a local filesystem or on a REST endpoint.
+// It can be used where Restic is not available. Archives are not deduplicated.
+type TarEngine struct {
+	Output map[string]utils.OutputFormat
+
+	storage archiveStorage
+}
+
+// archiveManifest describes a snapshot of the tar engine
+// It is written once the archive is stored.
+type archiveManifest struct {
+	Snapshot
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	Files  uint64 `json:"files"`
+	Bytes  int64  `json:"bytes"`
+}
+
+// NewTarEngine returns a tar engine storing the archives at targetURL
+func NewTarEngine(targetURL string) (e *TarEngine, err error) {
+	storage, err := newArchiveStorage(targetURL)
+	if err != nil {
+		return
+	}
+
+	e = &TarEngine{
+		Output:  make(map[string]utils.OutputFormat),
+		storage: storage,
+	}
+	return
+}
+
+// GetName returns the engine name
+func (*TarEngine) GetName() string {
+	return "tar"
+}
+
+// Backup performs the backup of the passed volume
+func (e *TarEngine) Backup(backupPath, hostname string, force bool, opts BackupOptions) string {
+	start := time.Now()
+	manifest, skipped, err := e.backupVolume(hostname, backupPath, opts)
+	var output []byte
+	for _, p := range skipped {
+		output = append(output, []byte(fmt.Sprintf("warning: skipped unsupported file %s\n", p))...)
+	}
+	e.setOutput("backup", append(output, e.summary(manifest, time.Since(start))...), err)
+	if err != nil {
+		return utils.ReturnFormattedOutput(e.Output)
+	}
+
+	err = e.Forget()
+	if err != nil {
+		return utils.ReturnFormattedOutput(e.Output)
+	}
+
+	e.retrieveBackupsStats()
+	e.retrieveRepositoryStats()
+	return utils.ReturnFormattedOutput(e.Output)
+}
+
+// Restore performs the restore of the passed volume
+func (e *TarEngine) Restore(backupPath, hostname string, force bool, snapshotName string, opts RestoreOptions) string {
+	files, err := e.restoreVolume(backupPath, snapshotName, opts)
+	e.setOutput("restore", []byte(fmt.Sprintf("restored %d files from snapshot %s", files, snapshotName)), err)
+	if err != nil {
+		return utils.ReturnFormattedOutput(e.Output)
+	}
+
+	e.retrieveBackupsStats()
+	return utils.ReturnFormattedOutput(e.Output)
+}
+
+// Snapshots returns the snapshots of the repository, the oldest first
+func (e *TarEngine) Snapshots() (snapshots []Snapshot, err error) {
+	manifests, err := e.getManifests()
+	if err != nil {
+		return
+	}
+
+	snapshots = []Snapshot{}
+	for _, m := range manifests {
+		snapshots = append(snapshots, m.Snapshot)
+	}
+	return
+}
+
+// Ls returns the content of the directory dir of a snapshot, dir being relative to the root of the volume
+func (e *TarEngine) Ls(snapshotName, dir string) (nodes []Node, err error) {
+	tr, closeArchive, err := e.openArchive(snapshotName)
+	if err != nil {
+		return
+	}
+	defer closeArchive()
+
+	var all []Node
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read archive: %s", err)
+			return
+		}
+		all = append(all, getTarNode(hdr))
+	}
+	nodes = filterNodes(all, dir)
+	return
+}
+
+// Dump writes the file p of a snapshot to w, or a tar archive of p if it is a directory
+// p is relative to the root of the volume, as are the paths in the tar archive.
+func (e *TarEngine) Dump(ctx context.Context, snapshotName, p string, w io.Writer) (err error) {
+	tr, closeArchive, err := e.openArchive(snapshotName)
+	if err != nil {
+		return
+	}
+	defer closeArchive()
+
+	p = cleanSnapshotPath(p)
+	var tw *tar.Writer
+	if p == "/" {
+		tw = tar.NewWriter(w)
+	}
+
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read archive: %s", err)
+			return
+		}
+
+		name := cleanSnapshotPath(hdr.Name)
+		switch {
+		case name == p && hdr.Typeflag == tar.TypeDir:
+			tw = tar.NewWriter(w)
+		case name == p:
+			_, err = io.Copy(w, tr)
+			if err != nil {
+				err = fmt.Errorf("failed to dump file: %s", err)
+			}
+			return
+		case tw == nil || !strings.HasPrefix(name, strings.TrimSuffix(p, "/")+"/"):
+			continue
+		}
+
+		err = tw.WriteHeader(hdr)
+		if err == nil {
+			_, err = io.Copy(tw, tr)
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to dump directory: %s", err)
+			return
+		}
+	}
+
+	if tw == nil {
+		err = fmt.Errorf("path `%s' not found in snapshot", p)
+		return
+	}
+	err = tw.Close()
+	return
+}
+
+// getTarNode returns the node of an archive entry, with the same types as restic
+func getTarNode(hdr *tar.Header) Node {
+	n := Node{
+		Name:    path.Base(hdr.Name),
+		Type:    "file",
+		Path:    cleanSnapshotPath(hdr.Name),
+		Size:    uint64(hdr.Size),
+		Mode:    hdr.FileInfo().Mode(),
+		ModTime: hdr.ModTime,
+	}
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		n.Type = "dir"
+	case tar.TypeSymlink:
+		n.Type = "symlink"
+	}
+	return n
+}
+
+// Forget removes the manifests of the snapshots according to the --keep-* options set in RESTIC_FORGET_ARGS
+// The archives of the forgotten snapshots are removed by Prune.
+func (e *TarEngine) Forget() (err error) {
+	var output bytes.Buffer
+	defer func() {
+		e.setOutput("forget", output.Bytes(), err)
+	}()
+
+	policy, err := parseRetentionPolicy(os.Getenv("RESTIC_FORGET_ARGS"))
+	if err != nil {
+		err = fmt.Errorf("failed to parse retention policy: %s", err)
+		return
+	}
+
+	snapshots, err := e.Snapshots()
+	if err != nil {
+		return
+	}
+
+	_, remove := policy.apply(snapshots)
+	for _, s := range remove {
+		err = e.storage.Delete(s.ID + manifestExt)
+		if err != nil {
+			err = fmt.Errorf("failed to remove snapshot %s: %s", s.ShortID, err)
+			return
+		}
+		fmt.Fprintf(&output, "removed snapshot %s\n", s.ShortID)
+	}
+	return
+}
+
+// Prune removes the archives which have no manifest
+func (e *TarEngine) Prune() string {
+	e.prune()
+	e.retrieveRepositoryStats()
+	return utils.ReturnFormattedOutput(e.Output)
+}
+
+func (e *TarEngine) prune() (err error) {
+	var output bytes.Buffer
+	defer func() {
+		e.setOutput("prune", output.Bytes(), err)
+	}()
+
+	names, err := e.storage.List()
+	if err != nil {
+		err = fmt.Errorf("failed to list repository: %s", err)
+		return
+	}
+
+	manifests := make(map[string]bool)
+	for _, name := range names {
+		if strings.HasSuffix(name, manifestExt) {
+			manifests[strings.TrimSuffix(name, manifestExt)] = true
+		}
+	}
+
+	for _, name := range names {
+		id := strings.TrimSuffix(name, archiveExt)
+		if !strings.HasSuffix(name, archiveExt) || manifests[id] {
+			continue
+		}
+		err = e.storage.Delete(name)
+		if err != nil {
+			err = fmt.Errorf("failed to remove archive %s: %s", name, err)
+			return
+		}
+		fmt.Fprintf(&output, "removed archive %s\n", name)
+	}
+	return
+}
+
+// Check verifies the checksum of the archives
+// Only a subset of the archives is verified if readDataSubset is set, e.g. `1/5` or `10%`.
+func (e *TarEngine) Check(readDataSubset string) string {
+	e.check(readDataSubset)
+	return utils.ReturnFormattedOutput(e.Output)
+}
+
+func (e *TarEngine) check(readDataSubset string) (err error) {
+	var output bytes.Buffer
+	defer func() {
+		e.setOutput("check", output.Bytes(), err)
+	}()
+
+	manifests, err := e.getManifests()
+	if err != nil {
+		return
+	}
+
+	manifests, err = selectSubset(manifests, readDataSubset)
+	if err != nil {
+		return
+	}
+
+	damaged := 0
+	for _, m := range manifests {
+		checkErr := e.checkArchive(m)
+		if checkErr != nil {
+			damaged++
+			fmt.Fprintf(&output, "snapshot %s: %s\n", m.ShortID, checkErr)
+			continue
+		}
+		fmt.Fprintf(&output, "snapshot %s: ok\n", m.ShortID)
+	}
+
+	if damaged > 0 {
+		err = fmt.Errorf("%d damaged snapshots", damaged)
+	}
+	return
+}
+
+// Stats returns the size of the repository
+func (e *TarEngine) Stats() (stats Stats, err error) {
+	manifests, err := e.getManifests()
+	if err != nil {
+		return
+	}
+
+	for _, m := range manifests {
+		stats.TotalSize += uint64(m.Size)
+		stats.TotalFileCount += m.Files
+	}
+	return
+}
+
+// setOutput records the output of a step as the Restic engine does
+func (e *TarEngine) setOutput(step string, output []byte, err error) {
+	rc := 0
+	if err != nil {
+		rc = 1
+		output = append(output, []byte(fmt.Sprintf("\nerror: %s", err))...)
+	}
+	e.Output[step] = utils.OutputFormat{
+		Stdout:   base64.StdEncoding.EncodeToString(output),
+		ExitCode: rc,
+	}
+}
+
+// summary mimics the summary message of `restic backup --json`
+// As archives are not deduplicated, all files are new.
+func (e *TarEngine) summary(manifest archiveManifest, duration time.Duration) []byte {
+	if manifest.ID == "" {
+		return nil
+	}
+
+	b, _ := json.Marshal(BackupSummary{
+		MessageType:         "summary",
+		FilesNew:            int(manifest.Files),
+		DataAdded:           manifest.Size,
+		TotalFilesProcessed: int(manifest.Files),
+		TotalBytesProcessed: manifest.Bytes,
+		TotalDuration:       duration.Seconds(),
+		SnapshotID:          manifest.ID,
+	})
+	return b
+}
+
+func (e *TarEngine) retrieveBackupsStats() {
+	snapshots, err := e.Snapshots()
+	b, _ := json.Marshal(snapshots)
+	e.setOutput("snapshots", b, err)
+}
+
+// retrieveRepositoryStats records the repository size
+// It is only informative, a failure is not recorded to avoid failing the backup.
+func (e *TarEngine) retrieveRepositoryStats() {
+	stats, err := e.Stats()
+	if err != nil {
+		return
+	}
+
+	b, _ := json.Marshal(stats)
+	e.setOutput("stats", b, nil)
+}
+
+// backupVolume streams the archive of the volume to the storage
+// The paths of the files which cannot be archived, e.g. sockets, are returned in skipped.
+func (e *TarEngine) backupVolume(hostname, backupPath string, opts BackupOptions) (manifest archiveManifest, skipped []string, err error) {
+	patterns, err := getExcludePatterns(backupPath, opts)
+	if err != nil {
+		return
+	}
+
+	id, err := newSnapshotID()
+	if err != nil {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	hash := sha256.New()
+	archive := &countingWriter{w: io.MultiWriter(pw, hash)}
+
+	var files uint64
+	var bytesProcessed int64
+	archived := make(chan error, 1)
+	go func() {
+		gw := gzip.NewWriter(archive)
+		tw := tar.NewWriter(gw)
+
+		var archiveErr error
+		files, bytesProcessed, skipped, archiveErr = writeArchive(tw, backupPath, patterns)
+		if archiveErr == nil {
+			archiveErr = tw.Close()
+		}
+		if archiveErr == nil {
+			archiveErr = gw.Close()
+		}
+		pw.CloseWithError(archiveErr)
+		archived <- archiveErr
+	}()
+
+	// The error of the archiving, if any, is returned by the storage as it reads the pipe
+	err = e.storage.Put(id+archiveExt, pr)
+	pr.CloseWithError(fmt.Errorf("failed to store archive"))
+	archiveErr := <-archived
+	if err != nil {
+		err = fmt.Errorf("failed to store archive: %s", err)
+		return
+	}
+	if archiveErr != nil {
+		err = fmt.Errorf("failed to archive volume: %s", archiveErr)
+		return
+	}
+
+	m := archiveManifest{
+		Snapshot: Snapshot{
+			Time:     time.Now().UTC(),
+			Path:     []string{backupPath},
+			Hostname: hostname,
+			ID:       id,
+			ShortID:  id[:8],
+			Tags:     opts.Tags,
+		},
+		SHA256: hex.EncodeToString(hash.Sum(nil)),
+		Size:   archive.n,
+		Files:  files,
+		Bytes:  bytesProcessed,
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal manifest: %s", err)
+		return
+	}
+	err = e.storage.Put(id+manifestExt, bytes.NewReader(b))
+	if err != nil {
+		err = fmt.Errorf("failed to store manifest: %s", err)
+		return
+	}
+
+	manifest = m
+	return
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = c.w.Write(p)
+	c.n += int64(n)
+	return
+}
+
+func (e *TarEngine) restoreVolume(backupPath, snapshotName string, opts RestoreOptions) (files uint64, err error) {
+	tr, closeArchive, err := e.openArchive(snapshotName)
+	if err != nil {
+		return
+	}
+	defer closeArchive()
+
+	files, err = extractArchive(tr, backupPath, opts)
+	if err != nil {
+		err = fmt.Errorf("failed to extract archive: %s", err)
+	}
+	return
+}
+
+// openArchive downloads the archive of a snapshot and returns a reader of its content
+// closeArchive must be called once the archive has been read.
+func (e *TarEngine) openArchive(snapshotName string) (tr *tar.Reader, closeArchive func(), err error) {
+	manifest, err := e.getManifest(snapshotName)
+	if err != nil {
+		return
+	}
+
+	tmp, err := e.downloadArchive(manifest)
+	if err != nil {
+		return
+	}
+
+	gr, err := gzip.NewReader(tmp)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		err = fmt.Errorf("failed to read archive: %s", err)
+		return
+	}
+
+	tr = tar.NewReader(gr)
+	closeArchive = func() {
+		gr.Close()
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}
+	return
+}
+
+func (e *TarEngine) checkArchive(manifest archiveManifest) (err error) {
+	tmp, err := e.downloadArchive(manifest)
+	if err != nil {
+		return
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+	return
+}
+
+// downloadArchive copies the archive of a snapshot into a temporary file and verifies its checksum
+func (e *TarEngine) downloadArchive(manifest archiveManifest) (tmp *os.File, err error) {
+	r, err := e.storage.Get(manifest.ID + archiveExt)
+	if err != nil {
+		err = fmt.Errorf("failed to get archive: %s", err)
+		return
+	}
+	defer r.Close()
+
+	tmp, err = ioutil.TempFile("", "bivac-")
+	if err != nil {
+		err = fmt.Errorf("failed to create temporary file: %s", err)
+		return
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err == nil && size != manifest.Size {
+		err = fmt.Errorf("size mismatch: %d bytes instead of %d", size, manifest.Size)
+	}
+	if err == nil && hex.EncodeToString(hash.Sum(nil)) != manifest.SHA256 {
+		err = fmt.Errorf("checksum mismatch")
+	}
+	if err == nil {
+		_, err = tmp.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		err = fmt.Errorf("failed to download archive: %s", err)
+	}
+	return
+}
+
+// getManifests returns the manifests of all the snapshots, the oldest first
+func (e *TarEngine) getManifests() (manifests []archiveManifest, err error) {
+	names, err := e.storage.List()
+	if err != nil {
+		err = fmt.Errorf("failed to list snapshots: %s", err)
+		return
+	}
+
+	for _, name := range names {
+		if !strings.HasSuffix(name, manifestExt) {
+			continue
+		}
+
+		var m archiveManifest
+		m, err = e.readManifest(name)
+		if err != nil {
+			return
+		}
+		manifests = append(manifests, m)
+	}
+
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].Time.Before(manifests[j].Time)
+	})
+	return
+}
+
+// getManifest returns the manifest of the latest snapshot or of the snapshot matching an ID or a short ID
+func (e *TarEngine) getManifest(snapshotName string) (manifest archiveManifest, err error) {
+	manifests, err := e.getManifests()
+	if err != nil {
+		return
+	}
+
+	if snapshotName == "latest" && len(manifests) > 0 {
+		manifest = manifests[len(manifests)-1]
+		return
+	}
+	for _, m := range manifests {
+		if m.ID == snapshotName || m.ShortID == snapshotName {
+			manifest = m
+			return
+		}
+	}
+	err = fmt.Errorf("snapshot `%s' not found", snapshotName)
+	return
+}
+
+func (e *TarEngine) readManifest(name string) (manifest archiveManifest, err error) {
+	r, err := e.storage.Get(name)
+	if err != nil {
+		err = fmt.Errorf("failed to get manifest %s: %s", name, err)
+		return
+	}
+	defer r.Close()
+
+	err = json.NewDecoder(r).Decode(&manifest)
+	if err != nil {
+		err = fmt.Errorf("failed to unmarshal manifest %s: %s", name, err)
+	}
+	return
+}
+
+// selectSubset returns the nth group of manifests out of t for a `n/t` subset
+// or a random selection of manifests for a `x%` subset
+func selectSubset(manifests []archiveManifest, subset string) (selected []archiveManifest, err error) {
+	if subset == "" {
+		return manifests, nil
+	}
+
+	if strings.HasSuffix(subset, "%") {
+		var percent float64
+		percent, err = strconv.ParseFloat(strings.TrimSuffix(subset, "%"), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			err = fmt.Errorf("invalid subset `%s'", subset)
+			return
+		}
+
+		count := int(math.Ceil(float64(len(manifests)) * percent / 100))
+		for _, i := range mrand.Perm(len(manifests))[:count] {
+			selected = append(selected, manifests[i])
+		}
+		return
+	}
+
+	var n, t int
+	_, err = fmt.Sscanf(subset, "%d/%d", &n, &t)
+	if err != nil || n < 1 || n > t {
+		err = fmt.Errorf("invalid subset `%s'", subset)
+		return
+	}
+	for i, m := range manifests {
+		if i%t == n-1 {
+			selected = append(selected, m)
+		}
+	}
+	return
+}
+
+func newSnapshotID() (id string, err error) {
+	b := make([]byte, 32)
+	_, err = rand.Read(b)
+	if err != nil {
+		err = fmt.Errorf("failed to generate snapshot ID: %s", err)
+		return
+	}
+	id = hex.EncodeToString(b)
+	return
+}
+
+// writeArchive adds the content of root to an archive, with paths relative to root
+// Paths matching the exclude patterns are skipped, as are sockets which cannot be archived.
+func writeArchive(tw *tar.Writer, root string, excludes []string) (files uint64, bytesProcessed int64, skipped []string, err error) {
+	err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if isExcluded(excludes, rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.Mode()&os.ModeSocket != 0 {
+			skipped = append(skipped, filepath.ToSlash(rel))
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(path)
+			if err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		err = tw.WriteHeader(hdr)
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		n, err := io.Copy(tw, f)
+		if err != nil {
+			return err
+		}
+		files++
+		bytesProcessed += n
+		return nil
+	})
+	return
+}
+
+// extractArchive writes the content of an archive selected by opts into root
+// Existing files are overwritten, other files are left untouched.
+// The owners of the files are restored when running as root.
+func extractArchive(tr *tar.Reader, root string, opts RestoreOptions) (files uint64, err error) {
+	root = filepath.Clean(root)
+
+	// The modification dates of the directories are set once their content is extracted
+	var dirs []*tar.Header
+	defer func() {
+		for i := len(dirs) - 1; i >= 0; i-- {
+			// The directory may have been replaced by a symlink since it was extracted
+			path := filepath.Join(root, filepath.FromSlash(dirs[i].Name))
+			if info, err := os.Lstat(path); err == nil && info.IsDir() {
+				os.Chtimes(path, dirs[i].ModTime, dirs[i].ModTime)
+			}
+		}
+	}()
+
+	for {
+		var hdr *tar.Header
+		hdr, err = tr.Next()
+		if err == io.EOF {
+			err = nil
+			return
+		}
+		if err != nil {
+			return
+		}
+
+		target, pathErr := getArchiveTarget(root, hdr.Name)
+		if pathErr != nil {
+			err = pathErr
+			return
+		}
+		if !opts.isRestored(hdr.Name) {
+			continue
+		}
+
+		// The symlinks in the parents of the entry, e.g. extracted from a previous entry,
+		// are replaced by directories so that nothing is written outside of root
+		err = makeArchiveDirs(root, filepath.Dir(target))
+		if err != nil {
+			return
+		}
+
+		// Existing files are replaced instead of being written through, as symlinks or hard links
+		err = removeArchiveTarget(target)
+		if err != nil {
+			return
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, os.FileMode(hdr.Mode))
+			dirs = append(dirs, hdr)
+		case tar.TypeSymlink:
+			err = os.Symlink(hdr.Linkname, target)
+		case tar.TypeLink:
+			var source string
+			source, err = getArchiveLinkSource(root, hdr.Linkname)
+			if err != nil {
+				return
+			}
+			err = os.Link(source, target)
+			files++
+		case tar.TypeReg:
+			err = extractFile(tr, target, os.FileMode(hdr.Mode))
+			files++
+		default:
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		if os.Geteuid() == 0 {
+			os.Lchown(target, hdr.Uid, hdr.Gid)
+		}
+
+		if hdr.Typeflag == tar.TypeReg || hdr.Typeflag == tar.TypeLink {
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime)
+		}
+	}
+}
+
+// getArchiveTarget returns the path where an archive entry is extracted
+func getArchiveTarget(root, name string) (target string, err error) {
+	target = filepath.Join(root, filepath.FromSlash(name))
+	if !strings.HasPrefix(target, root+string(os.PathSeparator)) {
+		err = fmt.Errorf("invalid path in archive: `%s'", name)
+	}
+	return
+}
+
+// getArchiveLinkSource returns the path of the file targeted by a hard link entry
+// The file must not be reached through a symlink, which may point outside of root.
+func getArchiveLinkSource(root, name string) (source string, err error) {
+	source, err = getArchiveTarget(root, name)
+	if err != nil {
+		return
+	}
+
+	for _, dir := range getArchiveParents(root, source) {
+		info, lstatErr := os.Lstat(dir)
+		if lstatErr == nil && info.Mode()&os.ModeSymlink != 0 {
+			err = fmt.Errorf("invalid link in archive: `%s' is reached through a symlink", name)
+			return
+		}
+	}
+	return
+}
+
+// makeArchiveDirs creates dir and its parents below root, replacing the symlinks by directories
+func makeArchiveDirs(root, dir string) (err error) {
+	err = os.MkdirAll(root, 0755)
+	if err != nil {
+		return
+	}
+
+	for _, path := range append(getArchiveParents(root, dir), dir) {
+		if path == root {
+			continue
+		}
+
+		info, lstatErr := os.Lstat(path)
+		switch {
+		case os.IsNotExist(lstatErr):
+		case lstatErr != nil:
+			err = lstatErr
+			return
+		case info.IsDir():
+			continue
+		case info.Mode()&os.ModeSymlink != 0:
+			err = os.Remove(path)
+			if err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("failed to create directory `%s': not a directory", path)
+			return
+		}
+
+		err = os.Mkdir(path, 0755)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// getArchiveParents returns the parent directories of path below root, from the uppermost one
+func getArchiveParents(root, path string) (parents []string) {
+	for dir := filepath.Dir(path); strings.HasPrefix(dir, root+string(os.PathSeparator)); dir = filepath.Dir(dir) {
+		parents = append([]string{dir}, parents...)
+	}
+	return
+}
+
+// removeArchiveTarget removes path unless it is a directory
+func removeArchiveTarget(path string) (err error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || info.IsDir() {
+		return
+	}
+	return os.Remove(path)
+}
+
+func extractFile(r io.Reader, target string, mode os.FileMode) (err error) {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return
+	}
+
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return
+}
@@ -0,0 +1,512 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVolume(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bivac-volume")
+	assert.Nil(t, err)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "data"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "data", "foo"), []byte("foo"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "bar"), []byte("bar"), 0600))
+	return dir
+}
+
+// Backup / Restore
+func TestTarEngineBackupRestore(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	e, err := NewTarEngine("file://" + repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+	assert.Equal(t, e.Output["forget"].ExitCode, 0)
+
+	stdout, err := base64.StdEncoding.DecodeString(e.Output["backup"].Stdout)
+	assert.Nil(t, err)
+	summary, err := ParseBackupSummary(string(stdout))
+	assert.Nil(t, err)
+	assert.Equal(t, summary.FilesNew, 2)
+	assert.Equal(t, summary.TotalBytesProcessed, int64(6))
+	assert.Equal(t, e.Output["stats"].ExitCode, 0)
+
+	snapshots, err := e.Snapshots()
+	assert.Nil(t, err)
+	assert.Equal(t, len(snapshots), 1)
+	assert.Equal(t, snapshots[0].Hostname, "foo")
+	assert.Equal(t, snapshots[0].Path, []string{volume})
+
+	stats, err := e.Stats()
+	assert.Nil(t, err)
+	assert.Equal(t, stats.TotalFileCount, uint64(2))
+
+	e.Check("")
+	assert.Equal(t, e.Output["check"].ExitCode, 0)
+
+	// Modified and added files are restored, other files are kept
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(volume, "data", "foo"), []byte("modified"), 0644))
+	assert.Nil(t, os.Remove(filepath.Join(volume, "bar")))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(volume, "baz"), []byte("baz"), 0644))
+
+	e.Restore(volume, "foo", false, snapshots[0].ShortID, RestoreOptions{})
+	assert.Equal(t, e.Output["restore"].ExitCode, 0)
+
+	b, err := ioutil.ReadFile(filepath.Join(volume, "data", "foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "foo")
+	b, err = ioutil.ReadFile(filepath.Join(volume, "bar"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "bar")
+	_, err = os.Stat(filepath.Join(volume, "baz"))
+	assert.Nil(t, err)
+}
+
+func TestTarEngineCheckDamagedArchive(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	snapshots, err := e.Snapshots()
+	assert.Nil(t, err)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(repo, snapshots[0].ID+archiveExt), []byte("damaged"), 0644))
+	e.Check("")
+	assert.Equal(t, e.Output["check"].ExitCode, 1)
+
+	e.Restore(volume, "foo", false, "latest", RestoreOptions{})
+	assert.Equal(t, e.Output["restore"].ExitCode, 1)
+}
+
+func TestTarEnginePartialRestore(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(volume, "data", "baz"), []byte("baz"), 0644))
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+
+	assert.Nil(t, os.RemoveAll(filepath.Join(volume, "data")))
+	assert.Nil(t, os.Remove(filepath.Join(volume, "bar")))
+
+	// Only data/foo is restored
+	e.Restore(volume, "foo", false, "latest", RestoreOptions{
+		Includes: []string{"/data"},
+		Excludes: []string{"data/baz"},
+	})
+	assert.Equal(t, e.Output["restore"].ExitCode, 0)
+
+	b, err := ioutil.ReadFile(filepath.Join(volume, "data", "foo"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "foo")
+	_, err = os.Stat(filepath.Join(volume, "data", "baz"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(volume, "bar"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTarEngineBackupOptions(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(volume, "baz.tmp"), []byte("baz"), 0644))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(volume, ignoreFile), []byte("*.tmp\n"), 0644))
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{
+		Excludes: []string{"/data"},
+		Tags:     []string{"volume_name=foo"},
+	})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+
+	snapshots, err := e.Snapshots()
+	assert.Nil(t, err)
+	assert.Equal(t, snapshots[0].Tags, []string{"volume_name=foo"})
+
+	// Only bar and the ignore file are backed up
+	stdout, err := base64.StdEncoding.DecodeString(e.Output["backup"].Stdout)
+	assert.Nil(t, err)
+	summary, err := ParseBackupSummary(string(stdout))
+	assert.Nil(t, err)
+	assert.Equal(t, summary.FilesNew, 2)
+	assert.Equal(t, summary.TotalBytesProcessed, int64(9))
+}
+
+// Ls
+func TestTarEngineLs(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+
+	nodes, err := e.Ls("latest", "/")
+	assert.Nil(t, err)
+	var paths []string
+	for _, n := range nodes {
+		paths = append(paths, n.Path+":"+n.Type)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, paths, []string{"/bar:file", "/data:dir"})
+
+	nodes, err = e.Ls("latest", "data/foo")
+	assert.Nil(t, err)
+	assert.Equal(t, len(nodes), 1)
+	assert.Equal(t, nodes[0].Name, "foo")
+	assert.Equal(t, nodes[0].Size, uint64(3))
+	assert.Equal(t, nodes[0].Mode, os.FileMode(0644))
+
+	_, err = e.Ls("foo", "/")
+	assert.NotNil(t, err)
+}
+
+// Dump
+func TestTarEngineDump(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+
+	var file bytes.Buffer
+	assert.Nil(t, e.Dump(context.Background(), "latest", "/bar", &file))
+	assert.Equal(t, file.String(), "bar")
+
+	var dir bytes.Buffer
+	assert.Nil(t, e.Dump(context.Background(), "latest", "data", &dir))
+	var names []string
+	tr := tar.NewReader(&dir)
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	assert.Equal(t, names, []string{"data", "data/foo"})
+
+	assert.NotNil(t, e.Dump(context.Background(), "latest", "/missing", ioutil.Discard))
+}
+
+func TestTarEngineForget(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	os.Setenv("RESTIC_FORGET_ARGS", "--group-by host --keep-last 2 --prune")
+	defer os.Unsetenv("RESTIC_FORGET_ARGS")
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		e.Backup(volume, "foo", false, BackupOptions{})
+	}
+
+	snapshots, err := e.Snapshots()
+	assert.Nil(t, err)
+	assert.Equal(t, len(snapshots), 2)
+
+	// The archive of the forgotten snapshot remains until the repository is pruned
+	files, err := ioutil.ReadDir(repo)
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), 5)
+
+	e.Prune()
+	assert.Equal(t, e.Output["prune"].ExitCode, 0)
+	files, err = ioutil.ReadDir(repo)
+	assert.Nil(t, err)
+	assert.Equal(t, len(files), 4)
+}
+
+func TestTarEngineRESTStorage(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+
+	var mux sync.Mutex
+	files := make(map[string][]byte)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.Lock()
+		defer mux.Unlock()
+
+		name := strings.TrimPrefix(r.URL.Path, "/repo/")
+		switch {
+		case r.Method == "GET" && name == "":
+			names := []string{}
+			for n := range files {
+				names = append(names, n)
+			}
+			sort.Strings(names)
+			w.Write([]byte(`["` + strings.Join(names, `","`) + `"]`))
+		case r.Method == "GET":
+			b, ok := files[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		case r.Method == "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			files[name] = b
+		case r.Method == "DELETE":
+			delete(files, name)
+		}
+	}))
+	defer ts.Close()
+
+	e, err := NewTarEngine("rest:" + ts.URL + "/repo")
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+	assert.Equal(t, len(files), 2)
+
+	e.Check("")
+	assert.Equal(t, e.Output["check"].ExitCode, 0)
+
+	e.Restore(volume, "foo", false, "latest", RestoreOptions{})
+	assert.Equal(t, e.Output["restore"].ExitCode, 0)
+}
+
+func TestTarEngineBackupSocket(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	l, err := net.Listen("unix", filepath.Join(volume, "data", "sock"))
+	assert.Nil(t, err)
+	defer l.Close()
+
+	e, err := NewTarEngine(repo)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 0)
+
+	stdout, err := base64.StdEncoding.DecodeString(e.Output["backup"].Stdout)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(stdout), "warning: skipped unsupported file data/sock"))
+	summary, err := ParseBackupSummary(string(stdout))
+	assert.Nil(t, err)
+	assert.Equal(t, summary.FilesNew, 2)
+}
+
+func TestTarEngineBackupStorageFailure(t *testing.T) {
+	volume := newTestVolume(t)
+	defer os.RemoveAll(volume)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInsufficientStorage)
+	}))
+	defer ts.Close()
+
+	e, err := NewTarEngine("rest:" + ts.URL)
+	assert.Nil(t, err)
+	e.Backup(volume, "foo", false, BackupOptions{})
+	assert.Equal(t, e.Output["backup"].ExitCode, 1)
+}
+
+// extractArchive
+func TestExtractArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac-volume")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "volume")
+	outside := filepath.Join(dir, "outside")
+	assert.Nil(t, ioutil.WriteFile(outside, []byte("outside"), 0644))
+
+	// An existing symlink must not be followed
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "data"), 0755))
+	assert.Nil(t, os.Symlink(outside, filepath.Join(root, "data", "foo")))
+
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "data", Mode: 0755, Typeflag: tar.TypeDir, ModTime: modTime}))
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "data/foo", Mode: 0644, Size: 3, Typeflag: tar.TypeReg, ModTime: modTime}))
+	tw.Write([]byte("foo"))
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "data/bar", Linkname: "data/foo", Typeflag: tar.TypeLink, ModTime: modTime}))
+	assert.Nil(t, tw.Close())
+
+	files, err := extractArchive(tar.NewReader(&buf), root, RestoreOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, files, uint64(2))
+
+	b, err := ioutil.ReadFile(outside)
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "outside")
+	info, err := os.Lstat(filepath.Join(root, "data", "foo"))
+	assert.Nil(t, err)
+	assert.True(t, info.Mode().IsRegular())
+
+	b, err = ioutil.ReadFile(filepath.Join(root, "data", "bar"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "foo")
+
+	// The date of the directory is not changed by the extraction of its content
+	info, err = os.Stat(filepath.Join(root, "data"))
+	assert.Nil(t, err)
+	assert.True(t, info.ModTime().Equal(modTime))
+}
+
+func TestExtractArchiveThroughSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac-volume")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	root := filepath.Join(dir, "volume")
+	outside := filepath.Join(dir, "outside")
+	assert.Nil(t, os.MkdirAll(outside, 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644))
+
+	// A file is written below a symlink extracted from a previous entry
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "escape", Linkname: outside, Typeflag: tar.TypeSymlink}))
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "escape/secret", Mode: 0644, Size: 3, Typeflag: tar.TypeReg}))
+	tw.Write([]byte("foo"))
+	assert.Nil(t, tw.Close())
+
+	_, err = extractArchive(tar.NewReader(&buf), root, RestoreOptions{})
+	assert.Nil(t, err)
+
+	b, err := ioutil.ReadFile(filepath.Join(outside, "secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "secret")
+	info, err := os.Lstat(filepath.Join(root, "escape"))
+	assert.Nil(t, err)
+	assert.True(t, info.IsDir())
+	b, err = ioutil.ReadFile(filepath.Join(root, "escape", "secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "foo")
+
+	// A hard link targets a file below a symlink
+	buf.Reset()
+	tw = tar.NewWriter(&buf)
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "link", Linkname: outside, Typeflag: tar.TypeSymlink}))
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "stolen", Linkname: "link/secret", Typeflag: tar.TypeLink}))
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "stolen", Mode: 0644, Size: 3, Typeflag: tar.TypeReg}))
+	tw.Write([]byte("foo"))
+	assert.Nil(t, tw.Close())
+
+	_, err = extractArchive(tar.NewReader(&buf), root, RestoreOptions{})
+	assert.NotNil(t, err)
+
+	b, err = ioutil.ReadFile(filepath.Join(outside, "secret"))
+	assert.Nil(t, err)
+	assert.Equal(t, string(b), "secret")
+	_, err = os.Lstat(filepath.Join(root, "stolen"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExtractArchiveInvalidPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac-volume")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	assert.Nil(t, tw.WriteHeader(&tar.Header{Name: "../foo", Mode: 0644, Size: 3, Typeflag: tar.TypeReg}))
+	tw.Write([]byte("foo"))
+	assert.Nil(t, tw.Close())
+
+	_, err = extractArchive(tar.NewReader(&buf), filepath.Join(dir, "volume"), RestoreOptions{})
+	assert.NotNil(t, err)
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// newArchiveStorage
+func TestNewArchiveStorage(t *testing.T) {
+	s, err := newArchiveStorage("rest:http://localhost:8000/foo/")
+	assert.Nil(t, err)
+	assert.Equal(t, s.(*restStorage).url, "http://localhost:8000/foo")
+
+	s, err = newArchiveStorage("/backups/foo")
+	assert.Nil(t, err)
+	assert.Equal(t, s.(*fsStorage).dir, "/backups/foo")
+
+	_, err = newArchiveStorage("s3:s3.amazonaws.com/bucket")
+	assert.NotNil(t, err)
+}
+
+// IsLocalTarget
+func TestIsLocalTarget(t *testing.T) {
+	assert.True(t, IsLocalTarget("/backups"))
+	assert.True(t, IsLocalTarget("file:///backups"))
+	assert.True(t, IsLocalTarget("local:/backups"))
+	assert.False(t, IsLocalTarget("rest:http://localhost:8000/foo"))
+	assert.False(t, IsLocalTarget("s3:s3.amazonaws.com/bucket"))
+}
+
+// selectSubset
+func TestSelectSubset(t *testing.T) {
+	manifests := make([]archiveManifest, 10)
+	for i := range manifests {
+		manifests[i].ID = string(rune('a' + i))
+	}
+
+	selected, err := selectSubset(manifests, "")
+	assert.Nil(t, err)
+	assert.Equal(t, len(selected), 10)
+
+	selected, err = selectSubset(manifests, "2/3")
+	assert.Nil(t, err)
+	assert.Equal(t, len(selected), 3)
+	assert.Equal(t, selected[0].ID, "b")
+	assert.Equal(t, selected[1].ID, "e")
+
+	selected, err = selectSubset(manifests, "25%")
+	assert.Nil(t, err)
+	assert.Equal(t, len(selected), 3)
+
+	_, err = selectSubset(manifests, "4/3")
+	assert.NotNil(t, err)
+	_, err = selectSubset(manifests, "foo%")
+	assert.NotNil(t, err)
+}
@@ -1,10 +1,10 @@
 package manager
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os"
 	"regexp"
 	"strings"
 	"time"
@@ -16,17 +16,28 @@ import (
 	"github.com/camptocamp/bivac/pkg/volume"
 )
 
-func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
+func backupVolume(ctx context.Context, m *Manager, v *volume.Volume, force bool, trigger string) (err error) {
 
-	v.BackingUp = true
+	m.setBackingUp(v, true)
 	defer func() {
-		v.BackingUp = false
+		m.setBackingUp(v, false)
 		v.LastBackupStartDate = ""
 	}()
 
 	v.Mux.Lock()
 	defer v.Mux.Unlock()
 
+	run := m.startRun(v, "backup", trigger)
+	defer func() {
+		if ctx.Err() != nil {
+			m.setBackupInterrupted(v, ctx.Err())
+		} else {
+			m.setBackupResult(v, run, err)
+		}
+		m.endRun(ctx, run, err)
+		observeRun(v, run)
+	}()
+
 	useLogReceiver := false
 	if m.LogServer != "" {
 		useLogReceiver = true
@@ -40,6 +51,7 @@ func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
 		return
 	}
 
+	var preCmdErr error
 	if p.PreCmd != "" {
 		log.WithFields(log.Fields{
 			"volume":   v.Name,
@@ -47,13 +59,15 @@ func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
 			"provider": p.Name,
 		}).Debug("running pre-command...")
 
-		err = RunCmd(p, m.Orchestrator, v, p.PreCmd, "precmd")
-		if err != nil {
+		// The volume is still backed up but the backup fails, as its snapshot may be inconsistent
+		preCmdErr = RunCmd(p, m.Orchestrator, v, p.PreCmd, "precmd")
+		if preCmdErr != nil {
 			log.WithFields(log.Fields{
 				"volume":   v.Name,
 				"hostname": v.Hostname,
 				"provider": p.Name,
-			}).Warningf("failed to run pre-command: %s", err)
+			}).Warningf("failed to run pre-command: %s", preCmdErr)
+			run.Warnings = append(run.Warnings, fmt.Sprintf("failed to run pre-command: %s", preCmdErr))
 		}
 	}
 
@@ -66,12 +80,19 @@ func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
 		m.TargetURL + "/" + m.Orchestrator.GetPath(v) + "/" + v.RepoName,
 		"--host",
 		m.Orchestrator.GetPath(v),
+		"--engine",
+		m.getEngineName(),
 	}
 
 	if force {
 		cmd = append(cmd, "--force")
 	}
 
+	cmd = append(cmd, m.getPatternArgs(v)...)
+	for _, tag := range m.getSnapshotTags(v, p.Name, trigger) {
+		cmd = append(cmd, "--tag", tag)
+	}
+
 	if useLogReceiver {
 		cmd = append(cmd, []string{"--log.receiver", m.LogServer + "/backup/" + v.ID + "/logs"}...)
 	}
@@ -82,14 +103,24 @@ func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
 		"agent_image": m.AgentImage,
 	}).Debug("deploying agent...")
 
+	env, err := m.getAgentEnv(v)
+	if err != nil {
+		err = newBackupFailure(FailureCredentials, err)
+		return
+	}
+
+	untrack := trackAgent(v)
 	_, output, err := m.Orchestrator.DeployAgent(
+		ctx,
 		m.AgentImage,
 		cmd,
-		os.Environ(),
+		env,
 		v,
 	)
+	untrack()
 	if err != nil {
-		err = fmt.Errorf("failed to deploy agent: %s", err)
+		v.Metrics.AgentDeploymentFailures.Inc()
+		err = newBackupFailure(FailureAgentDeployment, fmt.Errorf("failed to deploy agent: %s", err))
 		return
 	}
 
@@ -111,6 +142,13 @@ func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
 		}
 	}
 
+	// The output of the agent is recorded by updateBackupLogs, either above or by the log receiver
+	if preCmdErr != nil {
+		err = newBackupFailure(FailurePreCommand, fmt.Errorf("failed to run pre-command: %s", preCmdErr))
+	} else if run.Status == "Failed" {
+		err = newBackupFailure(run.FailureKind, fmt.Errorf("agent failed to backup the volume"))
+	}
+
 	if p.PostCmd != "" {
 		log.WithFields(log.Fields{
 			"volume":   v.Name,
@@ -118,20 +156,34 @@ func backupVolume(m *Manager, v *volume.Volume, force bool) (err error) {
 			"provider": p.Name,
 		}).Debug("running post-command...")
 
-		err = RunCmd(p, m.Orchestrator, v, p.PostCmd, "postcmd")
-		if err != nil {
+		postCmdErr := RunCmd(p, m.Orchestrator, v, p.PostCmd, "postcmd")
+		if postCmdErr != nil {
 			log.WithFields(log.Fields{
 				"volume":   v.Name,
 				"hostname": v.Hostname,
-			}).Warningf("failed to run post-command: %s", err)
+			}).Warningf("failed to run post-command: %s", postCmdErr)
+			run.Warnings = append(run.Warnings, fmt.Sprintf("failed to run post-command: %s", postCmdErr))
 		}
 	}
 
 	return
 }
 
-func (m *Manager) attachOrphanAgent(containerID string, v *volume.Volume) {
-	defer func() { v.BackingUp = false }()
+func (m *Manager) attachOrphanAgent(parentCtx context.Context, containerID string, v *volume.Volume) {
+	defer m.setBackingUp(v, false)
+
+	ctx, cancel := context.WithTimeout(parentCtx, m.getBackupTimeout(v))
+	defer cancel()
+
+	var err error
+	run := m.startRun(v, "backup", volume.TriggerOrphan)
+	defer func() {
+		if ctx.Err() != nil {
+			m.setBackupInterrupted(v, ctx.Err())
+		}
+		m.endRun(ctx, run, err)
+		observeRun(v, run)
+	}()
 
 	p, err := m.Providers.GetProvider(m.Orchestrator, v)
 	if err != nil {
@@ -143,7 +195,10 @@ func (m *Manager) attachOrphanAgent(containerID string, v *volume.Volume) {
 		useLogReceiver = true
 	}
 
-	_, output, err := m.Orchestrator.AttachOrphanAgent(containerID, v.Namespace)
+	var output string
+	untrack := trackAgent(v)
+	_, output, err = m.Orchestrator.AttachOrphanAgent(ctx, containerID, v.Namespace)
+	untrack()
 	if err != nil {
 		log.WithFields(log.Fields{
 			"volume":   v.Name,
@@ -151,6 +206,7 @@ func (m *Manager) attachOrphanAgent(containerID string, v *volume.Volume) {
 		}).Errorf("failed to attach orphan agent: %s", err)
 		return
 	}
+	orphanAgentsRecoveredMetric.Inc()
 
 	if !useLogReceiver {
 		decodedOutput, err := base64.StdEncoding.DecodeString(strings.TrimSpace(output))
@@ -187,7 +243,70 @@ func (m *Manager) attachOrphanAgent(containerID string, v *volume.Volume) {
 	return
 }
 
+// setBackupResult records the outcome of a backup attempt which has not been interrupted
+// Consecutive failures are counted by countBackupFailure, once the retries are exhausted.
+func (m *Manager) setBackupResult(v *volume.Volume, run *volume.Run, err error) {
+	if err == nil {
+		if v.ConsecutiveFailures == 0 && v.LastFailureKind == "" {
+			return
+		}
+		v.ConsecutiveFailures = 0
+		v.LastFailureKind = ""
+		saveVolumeState(m, v)
+		return
+	}
+
+	kind := failureKind(err)
+	run.FailureKind = kind
+	v.LastFailureKind = kind
+	v.LastBackupStatus = "Failed"
+	v.Metrics.LastBackupStatus.Set(1.0)
+	v.LastBackupDate = time.Now().UTC().Format("2006-01-02 15:04:05")
+	saveVolumeState(m, v)
+	return
+}
+
+// countBackupFailure records that a backup has failed, once per scheduled or manual backup
+// It delays the next attempts, see rescheduleRetryPolicy.
+func (m *Manager) countBackupFailure(v *volume.Volume) {
+	v.ConsecutiveFailures++
+	saveVolumeState(m, v)
+	return
+}
+
+// setBackupInterrupted records that the backup of a volume has been cancelled or has timed out
+// so that it is retried later instead of being rescheduled immediately
+func (m *Manager) setBackupInterrupted(v *volume.Volume, reason error) {
+	v.LastBackupStatus = interruptedStatus(reason)
+	v.Metrics.LastBackupStatus.Set(1.0)
+	if reason == context.DeadlineExceeded {
+		v.Metrics.BackupTimeouts.Inc()
+	}
+	v.LastBackupDate = time.Now().UTC().Format("2006-01-02 15:04:05")
+	saveVolumeState(m, v)
+	return
+}
+
+// getPatternArgs returns the agent options excluding and including files from the backup of a volume
+// Includes take precedence over excludes, whether they are global or set on the volume:
+// a volume may include back files excluded globally but not exclude files included globally.
+func (m *Manager) getPatternArgs(v *volume.Volume) (args []string) {
+	for _, patterns := range [][]string{m.Excludes, v.Excludes} {
+		for _, p := range patterns {
+			args = append(args, "--exclude", p)
+		}
+	}
+	for _, patterns := range [][]string{m.Includes, v.Includes} {
+		for _, p := range patterns {
+			args = append(args, "--include", p)
+		}
+	}
+	return
+}
+
 func (m *Manager) updateBackupLogs(v *volume.Volume, agentOutput utils.MsgFormat) {
+	run := m.getCurrentRun(v.ID)
+
 	if agentOutput.Type != "success" {
 		v.LastBackupStatus = "Failed"
 		v.Metrics.LastBackupStatus.Set(1.0)
@@ -195,11 +314,34 @@ func (m *Manager) updateBackupLogs(v *volume.Volume, agentOutput utils.MsgFormat
 		success := true
 		v.Logs = make(map[string]string)
 		for stepKey, stepValue := range agentOutput.Content.(map[string]interface{}) {
-			if stepKey != "testInit" && stepValue.(map[string]interface{})["rc"].(float64) > 0.0 {
+			rc := int(stepValue.(map[string]interface{})["rc"].(float64))
+			if stepKey != "testInit" && rc > 0 {
 				success = false
 			}
 			stdout, _ := base64.StdEncoding.DecodeString(stepValue.(map[string]interface{})["stdout"].(string))
-			v.Logs[stepKey] = fmt.Sprintf("[%d] %s", int(stepValue.(map[string]interface{})["rc"].(float64)), stdout)
+			v.Logs[stepKey] = fmt.Sprintf("[%d] %s", rc, stdout)
+
+			if run != nil {
+				run.ExitCodes[stepKey] = rc
+			}
+
+			if stepKey == "backup" {
+				if summary, err := engine.ParseBackupSummary(string(stdout)); err == nil {
+					v.LastBackupStats = summary.GetStats()
+					v.Metrics.LastBackupBytesAdded.Set(float64(summary.DataAdded))
+					if run != nil {
+						run.SnapshotID = summary.SnapshotID
+						run.Stats = v.LastBackupStats
+					}
+				}
+			}
+
+			if stepKey == "stats" && rc == 0 {
+				var stats engine.Stats
+				if err := json.Unmarshal(stdout, &stats); err == nil {
+					v.Metrics.RepositorySize.Set(float64(stats.TotalSize))
+				}
+			}
 		}
 		if success {
 			v.LastBackupStatus = "Success"
@@ -214,7 +356,15 @@ func (m *Manager) updateBackupLogs(v *volume.Volume, agentOutput utils.MsgFormat
 		}
 	}
 
+	if run != nil {
+		run.Status = v.LastBackupStatus
+		if run.Status == "Failed" {
+			run.FailureKind = classifyAgentFailure(v, agentOutput)
+		}
+	}
+
 	v.LastBackupDate = time.Now().UTC().Format("2006-01-02 15:04:05")
+	saveVolumeState(m, v)
 	return
 }
 
@@ -248,13 +398,24 @@ func (m *Manager) setOldestBackupDate(v *volume.Volume) (err error) {
 
 // RunResticCommand runs a custom Restic command
 func (m *Manager) RunResticCommand(v *volume.Volume, cmd []string) (output string, err error) {
-	e := &engine.Engine{
+	if m.getEngineName() != "restic" {
+		err = fmt.Errorf("raw commands are not supported by the %s engine", m.getEngineName())
+		return
+	}
+
+	env, err := m.getAgentEnv(v)
+	if err != nil {
+		return
+	}
+
+	e := &engine.ResticEngine{
 		DefaultArgs: []string{
 			"--no-cache",
 			"-r",
 			m.TargetURL + "/" + m.Orchestrator.GetPath(v) + "/" + v.RepoName,
 		},
 		Output: make(map[string]utils.OutputFormat),
+		Env:    env,
 	}
 
 	err = e.RawCommand(cmd)
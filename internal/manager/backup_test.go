@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/internal/store"
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// updateBackupLogs
+func TestUpdateBackupLogsStats(t *testing.T) {
+	m := &Manager{
+		Store: store.NewMemoryStore(),
+	}
+	givenVolume := &volume.Volume{
+		ID:   "foo",
+		Name: "foo",
+	}
+	givenVolume.SetupMetrics()
+	defer givenVolume.CleanupMetrics()
+
+	summary := `{"message_type":"summary","files_new":2,"files_changed":1,"data_added":1024,"snapshot_id":"a1b2c3d4"}`
+	agentOutput := utils.MsgFormat{
+		Type: "success",
+		Content: map[string]interface{}{
+			"backup": map[string]interface{}{
+				"rc":     float64(0),
+				"stdout": base64.StdEncoding.EncodeToString([]byte(summary)),
+			},
+			"stats": map[string]interface{}{
+				"rc":     float64(0),
+				"stdout": base64.StdEncoding.EncodeToString([]byte(`{"total_size":4096,"total_file_count":3}`)),
+			},
+		},
+	}
+
+	run := m.startRun(givenVolume, "backup", volume.TriggerManual)
+	m.updateBackupLogs(givenVolume, agentOutput)
+
+	assert.Equal(t, givenVolume.LastBackupStatus, "Success")
+	assert.Equal(t, givenVolume.LastBackupStats.SnapshotID, "a1b2c3d4")
+	assert.Equal(t, givenVolume.LastBackupStats.FilesNew, 2)
+	assert.Equal(t, givenVolume.LastBackupStats.DataAdded, int64(1024))
+	assert.Equal(t, run.SnapshotID, "a1b2c3d4")
+	assert.Equal(t, run.Stats, givenVolume.LastBackupStats)
+	assert.Equal(t, testutil.ToFloat64(givenVolume.Metrics.LastBackupBytesAdded), float64(1024))
+	assert.Equal(t, testutil.ToFloat64(givenVolume.Metrics.RepositorySize), float64(4096))
+
+	state, found, err := m.Store.GetVolumeState("foo")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, state.LastBackupStats, givenVolume.LastBackupStats)
+}
+
+// getPatternArgs
+func TestGetPatternArgs(t *testing.T) {
+	m := &Manager{
+		Excludes: []string{"/lost+found"},
+	}
+	givenVolume := &volume.Volume{
+		Labels: map[string]string{
+			"bivac.exclude": "*.tmp, /cache/*",
+			"bivac.include": "/cache/keep",
+		},
+	}
+	m.setVolumeOptions(givenVolume)
+
+	assert.Equal(t, givenVolume.Excludes, []string{"*.tmp", "/cache/*"})
+	assert.Equal(t, m.getPatternArgs(givenVolume), []string{
+		"--exclude", "/lost+found",
+		"--exclude", "*.tmp",
+		"--exclude", "/cache/*",
+		"--include", "/cache/keep",
+	})
+}
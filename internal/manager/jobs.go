@@ -0,0 +1,176 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// jobsRetention is the time during which finished jobs can be retrieved
+const jobsRetention = 24 * time.Hour
+
+type job struct {
+	volume.Job
+
+	cancel context.CancelFunc
+}
+
+// ErrJobNotFound is returned when a job doesn't exist
+var ErrJobNotFound = fmt.Errorf("job not found")
+
+// ErrOutsideBackupWindow is returned when a backup is requested outside of the volume's backup window
+var ErrOutsideBackupWindow = fmt.Errorf("volume is outside of its backup window")
+
+// ErrVolumeNotFound is returned when a volume isn't managed by Bivac
+var ErrVolumeNotFound = fmt.Errorf("volume not found")
+
+// NewBackupJob requests an asynchronous backup of a volume
+// The backup is refused outside of the volume's backup window unless ignoreWindow is set.
+func (m *Manager) NewBackupJob(volumeID string, force, ignoreWindow bool) (j volume.Job, err error) {
+	v := m.getVolume(volumeID)
+	if v == nil {
+		err = ErrVolumeNotFound
+		return
+	}
+
+	if !ignoreWindow && !m.isInBackupWindow(v, time.Now()) {
+		err = ErrOutsideBackupWindow
+		return
+	}
+
+	j, err = m.submitJob("backup", volumeID, func(ctx context.Context) error {
+		err := m.BackupVolume(ctx, volumeID, force)
+		if err == nil && v.LastBackupStatus == "Failed" {
+			err = fmt.Errorf("backup failed, see the volume logs")
+		}
+		return err
+	})
+	return
+}
+
+// NewRestoreJob requests an asynchronous restore of a volume
+func (m *Manager) NewRestoreJob(volumeID string, force bool, snapshotName string, includes, excludes []string) (j volume.Job, err error) {
+	v := m.getVolume(volumeID)
+	if v == nil {
+		err = ErrVolumeNotFound
+		return
+	}
+
+	j, err = m.submitJob("restore", volumeID, func(ctx context.Context) error {
+		err := m.RestoreVolume(ctx, volumeID, force, snapshotName, includes, excludes)
+		if err == nil && v.LastBackupStatus == "Failed" {
+			err = fmt.Errorf("restore failed, see the volume logs")
+		}
+		return err
+	})
+	return
+}
+
+// GetJob returns a job
+func (m *Manager) GetJob(jobID string) (j volume.Job, err error) {
+	m.jobsMux.Lock()
+	defer m.jobsMux.Unlock()
+
+	if rj, ok := m.jobs[jobID]; ok {
+		j = rj.Job
+		return
+	}
+	err = ErrJobNotFound
+	return
+}
+
+// CancelJob cancels a job
+// The agent of a running job is stopped.
+func (m *Manager) CancelJob(jobID string) (j volume.Job, err error) {
+	m.jobsMux.Lock()
+	defer m.jobsMux.Unlock()
+
+	rj, ok := m.jobs[jobID]
+	if !ok {
+		err = ErrJobNotFound
+		return
+	}
+
+	switch rj.Status {
+	case volume.JobPending:
+		rj.cancel()
+		rj.Status = volume.JobCancelled
+		rj.EndDate = time.Now().UTC()
+	case volume.JobRunning:
+		// The job status is updated once the agent is stopped
+		rj.cancel()
+	}
+	j = rj.Job
+	return
+}
+
+// submitJob runs fn in background
+// The job is cancelled when the leadership is lost.
+func (m *Manager) submitJob(jobType, volumeID string, fn func(ctx context.Context) error) (submitted volume.Job, err error) {
+	if !m.beginAgent() {
+		err = ErrShuttingDown
+		return
+	}
+
+	parentCtx := m.getLeaderContext()
+	if parentCtx == nil {
+		parentCtx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parentCtx)
+	j := &job{
+		Job: volume.Job{
+			ID:           utils.GenerateRandomString(16),
+			Type:         jobType,
+			VolumeID:     volumeID,
+			Status:       volume.JobPending,
+			CreationDate: time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+
+	m.jobsMux.Lock()
+	if m.jobs == nil {
+		m.jobs = make(map[string]*job)
+	}
+	for id, oj := range m.jobs {
+		if oj.IsDone() && oj.EndDate.Add(jobsRetention).Before(time.Now().UTC()) {
+			delete(m.jobs, id)
+		}
+	}
+	m.jobs[j.ID] = j
+	submitted = j.Job
+	m.jobsMux.Unlock()
+
+	go func() {
+		defer m.endAgent()
+		defer cancel()
+
+		m.jobsMux.Lock()
+		if j.Status != volume.JobPending {
+			m.jobsMux.Unlock()
+			return
+		}
+		j.Status = volume.JobRunning
+		j.StartDate = time.Now().UTC()
+		m.jobsMux.Unlock()
+
+		err := fn(ctx)
+
+		m.jobsMux.Lock()
+		defer m.jobsMux.Unlock()
+		j.EndDate = time.Now().UTC()
+		if ctx.Err() != nil {
+			j.Status = volume.JobCancelled
+		} else if err != nil {
+			j.Status = volume.JobFailed
+			j.Error = err.Error()
+		} else {
+			j.Status = volume.JobSuccess
+		}
+	}()
+
+	return
+}
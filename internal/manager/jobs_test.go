@@ -0,0 +1,120 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+func waitJob(t *testing.T, m *Manager, jobID string) (j volume.Job) {
+	for i := 0; i < 100; i++ {
+		var err error
+		j, err = m.GetJob(jobID)
+		assert.Nil(t, err)
+		if j.IsDone() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job `%s' did not finish", jobID)
+	return
+}
+
+// submitJob
+func TestSubmitJobSuccess(t *testing.T) {
+	m := &Manager{}
+	release := make(chan bool)
+
+	j, err := m.submitJob("backup", "foo", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, j.VolumeID, "foo")
+
+	release <- true
+	j = waitJob(t, m, j.ID)
+	assert.Equal(t, j.Status, volume.JobSuccess)
+	assert.False(t, j.EndDate.IsZero())
+}
+
+func TestSubmitJobCancelled(t *testing.T) {
+	m := &Manager{}
+
+	j, err := m.submitJob("backup", "foo", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.Nil(t, err)
+
+	for j.Status != volume.JobRunning {
+		j, _ = m.GetJob(j.ID)
+	}
+	_, err = m.CancelJob(j.ID)
+	assert.Nil(t, err)
+
+	j = waitJob(t, m, j.ID)
+	assert.Equal(t, j.Status, volume.JobCancelled)
+}
+
+func TestSubmitJobFailed(t *testing.T) {
+	m := &Manager{}
+
+	j, err := m.submitJob("backup", "foo", func(ctx context.Context) error {
+		return errors.New("failed to deploy agent")
+	})
+	assert.Nil(t, err)
+
+	j = waitJob(t, m, j.ID)
+	assert.Equal(t, j.Status, volume.JobFailed)
+	assert.Equal(t, j.Error, "failed to deploy agent")
+}
+
+func TestSubmitJobShuttingDown(t *testing.T) {
+	m := &Manager{
+		shuttingDown: true,
+	}
+
+	_, err := m.submitJob("backup", "foo", func(ctx context.Context) error {
+		return nil
+	})
+	assert.Equal(t, err, ErrShuttingDown)
+}
+
+// GetJob
+func TestGetJobNotFound(t *testing.T) {
+	m := &Manager{}
+
+	_, err := m.GetJob("foo")
+	assert.Equal(t, err, ErrJobNotFound)
+	_, err = m.CancelJob("foo")
+	assert.Equal(t, err, ErrJobNotFound)
+}
+
+// NewBackupJob
+func TestNewBackupJobVolumeNotFound(t *testing.T) {
+	m := &Manager{}
+
+	_, err := m.NewBackupJob("foo", false, false)
+	assert.Equal(t, err, ErrVolumeNotFound)
+}
+
+func TestNewBackupJobOutsideBackupWindow(t *testing.T) {
+	m := &Manager{
+		Volumes: []*volume.Volume{
+			&volume.Volume{
+				ID:       "foo",
+				Name:     "foo",
+				Blackout: "00:00-00:00",
+			},
+		},
+	}
+
+	_, err := m.NewBackupJob("foo", false, false)
+	assert.Equal(t, err, ErrOutsideBackupWindow)
+}
@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/camptocamp/bivac/internal/utils"
+)
+
+var leaderMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "bivac",
+	Name:      "leader",
+	Help:      "Whether this manager is the leader which schedules backups",
+})
+
+// startLeaderElection campaigns for the leadership.
+// Only the leader schedules backups, other managers serve read-only API requests.
+// The leadership is released once ctx is done.
+func (m *Manager) startLeaderElection(ctx context.Context) (err error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		err = fmt.Errorf("failed to retrieve hostname: %s", err)
+		return
+	}
+	address, err := m.getAdvertiseAddress(hostname)
+	if err != nil {
+		err = fmt.Errorf("failed to get API address: %s", err)
+		return
+	}
+	// The address lets the other managers forward the requests which must be handled by the leader
+	identity := fmt.Sprintf("%s-%s@%s", hostname, utils.GenerateRandomString(6), address)
+	m.identity = identity
+
+	err = m.Orchestrator.RunLeaderElection(ctx, identity, m.onElected)
+	if err != nil {
+		err = fmt.Errorf("failed to run leader election: %s", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"identity": identity,
+	}).Info("Waiting for leadership...")
+	return
+}
+
+// onElected starts the scheduling of backups until ctx is done
+func (m *Manager) onElected(ctx context.Context) {
+	log.Info("Elected as leader.")
+
+	// The previous leader may have run backups and maintenance tasks since the states were loaded
+	reloadVolumeStates(m)
+
+	// Catch orphan agents, e.g. left by the previous leader
+	orphanAgents, err := m.Orchestrator.RetrieveOrphanAgents()
+	if err != nil {
+		log.Errorf("failed to retrieve orphan agents: %s", err)
+	}
+
+	m.leaderMux.Lock()
+	m.leaderCtx = ctx
+	m.orphanAgents = orphanAgents
+	m.leaderMux.Unlock()
+	leaderMetric.Set(1)
+
+	go func() {
+		<-ctx.Done()
+		leaderMetric.Set(0)
+		log.Warning("Leadership lost, running backups are cancelled.")
+	}()
+}
+
+// getLeaderContext returns a context which is cancelled when the leadership is lost.
+// nil is returned if the manager is not the leader.
+func (m *Manager) getLeaderContext() context.Context {
+	m.leaderMux.Lock()
+	defer m.leaderMux.Unlock()
+
+	if m.leaderCtx == nil || m.leaderCtx.Err() != nil {
+		return nil
+	}
+	return m.leaderCtx
+}
+
+func (m *Manager) isLeader() bool {
+	return m.getLeaderContext() != nil
+}
+
+// takeOrphanAgent returns the orphan agent backing up a volume, if any
+func (m *Manager) takeOrphanAgent(volumeID string) (containerID string, ok bool) {
+	m.leaderMux.Lock()
+	defer m.leaderMux.Unlock()
+
+	containerID, ok = m.orphanAgents[volumeID]
+	delete(m.orphanAgents, volumeID)
+	return
+}
+
+// getAdvertiseAddress returns the address on which the other managers can reach the API
+func (m *Manager) getAdvertiseAddress(hostname string) (address string, err error) {
+	_, port, err := net.SplitHostPort(m.Server.Address)
+	if err != nil {
+		err = fmt.Errorf("failed to parse server address: %s", err)
+		return
+	}
+
+	addresses, err := net.LookupHost(hostname)
+	if err != nil {
+		err = fmt.Errorf("failed to resolve hostname: %s", err)
+		return
+	}
+	address = net.JoinHostPort(addresses[0], port)
+	return
+}
+
+// getLeaderAddress returns the API address of the leader
+func (m *Manager) getLeaderAddress() (address string, err error) {
+	identity, err := m.Orchestrator.GetLeader()
+	if err != nil {
+		err = fmt.Errorf("failed to get leader: %s", err)
+		return
+	}
+	if identity == m.identity {
+		err = fmt.Errorf("leadership not taken yet")
+		return
+	}
+
+	i := strings.LastIndex(identity, "@")
+	if i < 0 {
+		err = fmt.Errorf("no address in leader identity `%s'", identity)
+		return
+	}
+	address = identity[i+1:]
+	return
+}
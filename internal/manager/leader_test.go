@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/internal/store"
+	"github.com/camptocamp/bivac/mocks"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// onElected
+func TestOnElected(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockOrchestrator := mocks.NewMockOrchestrator(mockCtrl)
+	mockOrchestrator.EXPECT().RetrieveOrphanAgents().Return(map[string]string{"foo": "bar"}, nil).Times(1)
+
+	m := &Manager{
+		Orchestrator: mockOrchestrator,
+	}
+	assert.False(t, m.isLeader())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.onElected(ctx)
+	assert.True(t, m.isLeader())
+
+	containerID, ok := m.takeOrphanAgent("foo")
+	assert.True(t, ok)
+	assert.Equal(t, containerID, "bar")
+	_, ok = m.takeOrphanAgent("foo")
+	assert.False(t, ok)
+
+	cancel()
+	assert.False(t, m.isLeader())
+}
+
+func TestOnElectedReloadsVolumeStates(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockOrchestrator := mocks.NewMockOrchestrator(mockCtrl)
+	mockOrchestrator.EXPECT().RetrieveOrphanAgents().Return(nil, nil).Times(1)
+	// The previous leader backed up and checked the volume since it was discovered
+	mockOrchestrator.EXPECT().GetSharedState().Return(map[string]string{
+		"foo": `{"LastBackupDate":"2020-01-02 10:30:00","LastBackupStatus":"Failed","LastFailureKind":"Backend","ConsecutiveFailures":2,"LastCheckDate":"2020-01-02 11:00:00"}`,
+	}, nil).Times(1)
+
+	givenVolume := &volume.Volume{
+		ID:             "foo",
+		Name:           "foo",
+		LastBackupDate: "2020-01-01 10:30:00",
+	}
+	givenVolume.SetupMetrics()
+	defer givenVolume.CleanupMetrics()
+	m := &Manager{
+		Orchestrator: mockOrchestrator,
+		Store:        store.NewSharedStore(store.NewMemoryStore(), mockOrchestrator),
+		Volumes:      []*volume.Volume{givenVolume},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	m.onElected(ctx)
+	assert.Equal(t, givenVolume.LastBackupDate, "2020-01-02 10:30:00")
+	assert.Equal(t, givenVolume.LastBackupStatus, "Failed")
+	assert.Equal(t, givenVolume.LastFailureKind, FailureBackend)
+	assert.Equal(t, givenVolume.ConsecutiveFailures, 2)
+	assert.Equal(t, givenVolume.LastCheckDate, "2020-01-02 11:00:00")
+}
+
+// handleLeaderRequest
+func TestHandleLeaderRequest(t *testing.T) {
+	m := &Manager{}
+	handler := m.handleLeaderRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/backup/foo", nil))
+	assert.Equal(t, rec.Code, http.StatusServiceUnavailable)
+
+	m.leaderCtx = context.Background()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/backup/foo", nil))
+	assert.Equal(t, rec.Code, http.StatusOK)
+}
+
+// handleLeaderForward
+func TestHandleLeaderForward(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockOrchestrator := mocks.NewMockOrchestrator(mockCtrl)
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("leader " + r.URL.Path))
+	}))
+	defer leader.Close()
+	leaderURL, _ := url.Parse(leader.URL)
+
+	m := &Manager{
+		Orchestrator: mockOrchestrator,
+		identity:     "bar-def@127.0.0.1:1",
+	}
+	handler := m.handleLeaderForward(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("follower"))
+	}))
+
+	// The logs are forwarded to the leader
+	mockOrchestrator.EXPECT().GetLeader().Return(fmt.Sprintf("foo-abc@%s", leaderURL.Host), nil).Times(1)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/backup/foo/logs", nil))
+	assert.Equal(t, rec.Code, http.StatusOK)
+	body, _ := ioutil.ReadAll(rec.Body)
+	assert.Equal(t, string(body), "leader /backup/foo/logs")
+
+	// The manager has not been notified of its election yet
+	mockOrchestrator.EXPECT().GetLeader().Return(m.identity, nil).Times(1)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/backup/foo/logs", nil))
+	assert.Equal(t, rec.Code, http.StatusServiceUnavailable)
+
+	m.leaderCtx = context.Background()
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/backup/foo/logs", nil))
+	body, _ = ioutil.ReadAll(rec.Body)
+	assert.Equal(t, string(body), "follower")
+}
+
+// newRouter
+func TestNewRouterForwardsJobs(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockOrchestrator := mocks.NewMockOrchestrator(mockCtrl)
+
+	leader := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("leader " + r.URL.Path))
+	}))
+	defer leader.Close()
+	leaderURL, _ := url.Parse(leader.URL)
+
+	m := &Manager{
+		Orchestrator: mockOrchestrator,
+		Server:       &Server{PSK: "foo"},
+		identity:     "bar-def@127.0.0.1:1",
+	}
+	router := m.newRouter()
+
+	// The jobs and the queue are only known by the leader
+	mockOrchestrator.EXPECT().GetLeader().Return(fmt.Sprintf("foo-abc@%s", leaderURL.Host), nil).Times(2)
+	for _, path := range []string{"/jobs/123", "/queue"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer foo")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, rec.Code, http.StatusOK)
+		body, _ := ioutil.ReadAll(rec.Body)
+		assert.Equal(t, string(body), "leader "+path)
+	}
+}
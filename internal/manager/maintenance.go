@@ -0,0 +1,340 @@
+package manager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/camptocamp/bivac/internal/engine"
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// Repository maintenance tasks, run by agents out of the backup path
+const (
+	taskCheck = "check"
+	taskPrune = "prune"
+)
+
+// maintenanceSchedule defines how often and how many maintenance agents of a same task are run
+type maintenanceSchedule struct {
+	task          string
+	interval      time.Duration
+	parallelCount int
+	timeout       func(v *volume.Volume) time.Duration
+	args          []string
+}
+
+// getMaintenanceSchedules returns the enabled maintenance tasks
+func (m *Manager) getMaintenanceSchedules() (schedules []maintenanceSchedule) {
+	if m.CheckInterval > 0 {
+		var args []string
+		if m.CheckReadDataSubset != "" {
+			args = []string{"--read-data-subset", m.CheckReadDataSubset}
+		}
+		// Checks are run one at a time
+		schedules = append(schedules, maintenanceSchedule{
+			task:          taskCheck,
+			interval:      m.CheckInterval,
+			parallelCount: 1,
+			timeout:       m.getBackupTimeout,
+			args:          args,
+		})
+	}
+	if m.PruneInterval > 0 {
+		schedules = append(schedules, maintenanceSchedule{
+			task:          taskPrune,
+			interval:      m.PruneInterval,
+			parallelCount: m.PruneParallelCount,
+			timeout:       func(v *volume.Volume) time.Duration { return m.PruneTimeout },
+		})
+	}
+	return
+}
+
+// manageMaintenance runs a maintenance task on the repositories of the volumes every s.interval
+// Tasks only run on the leader, outside of the backups of the volume and of its blackout periods.
+// At most s.parallelCount agents run the task at once, within the agent limits of the backups.
+// The other volumes wait for the next round.
+func (m *Manager) manageMaintenance(s maintenanceSchedule, refreshInterval time.Duration) {
+	log.Infof("Starting %s manager...", s.task)
+
+	parallelCount := s.parallelCount
+	if parallelCount < 1 {
+		parallelCount = 1
+	}
+	slots := make(chan bool, parallelCount)
+
+	for {
+		for _, v := range m.Volumes {
+			leaderCtx := m.getLeaderContext()
+			if leaderCtx == nil || m.isShuttingDown() {
+				break
+			}
+
+			next := m.getNextMaintenanceDate(v, s.task, s.interval)
+			setNextMaintenanceDate(v, s.task, next)
+			if next.After(time.Now().UTC()) || !m.isInBackupWindow(v, time.Now()) {
+				continue
+			}
+
+			if !m.beginMaintenance(v, s.task) {
+				continue
+			}
+			select {
+			case slots <- true:
+			default:
+				m.endMaintenance(v)
+				continue
+			}
+			if !m.slots.acquire(v) {
+				<-slots
+				m.endMaintenance(v)
+				continue
+			}
+			if !m.beginAgent() {
+				m.releaseSlot(v)
+				<-slots
+				m.endMaintenance(v)
+				break
+			}
+
+			go func(v *volume.Volume) {
+				defer func() {
+					m.endMaintenance(v)
+					m.releaseSlot(v)
+					m.endAgent()
+					<-slots
+				}()
+
+				ctx, cancel := context.WithTimeout(leaderCtx, s.timeout(v))
+				defer cancel()
+				err := runMaintenanceAgent(ctx, m, v, s.task, s.args)
+				if err != nil {
+					log.WithFields(log.Fields{
+						"volume":   v.Name,
+						"hostname": v.Hostname,
+						"task":     s.task,
+					}).Errorf("failed to run maintenance: %s", err)
+				}
+			}(v)
+		}
+
+		time.Sleep(refreshInterval)
+	}
+}
+
+// beginMaintenance marks a maintenance task as running on the volume
+// false is returned if the volume is being backed up or if another task is running on it.
+func (m *Manager) beginMaintenance(v *volume.Volume, task string) bool {
+	m.tasksMux.Lock()
+	defer m.tasksMux.Unlock()
+
+	if v.BackingUp || v.MaintenanceTask != "" {
+		return false
+	}
+	v.MaintenanceTask = task
+	return true
+}
+
+// endMaintenance marks the maintenance task of the volume as done
+func (m *Manager) endMaintenance(v *volume.Volume) {
+	m.tasksMux.Lock()
+	defer m.tasksMux.Unlock()
+
+	v.MaintenanceTask = ""
+}
+
+// beginBackup marks the volume as being backed up by the scheduler
+// false is returned if a maintenance task is running on the volume.
+func (m *Manager) beginBackup(v *volume.Volume) bool {
+	m.tasksMux.Lock()
+	defer m.tasksMux.Unlock()
+
+	if v.MaintenanceTask != "" {
+		return false
+	}
+	v.BackingUp = true
+	return true
+}
+
+func (m *Manager) setBackingUp(v *volume.Volume, backingUp bool) {
+	m.tasksMux.Lock()
+	defer m.tasksMux.Unlock()
+
+	v.BackingUp = backingUp
+}
+
+// getNextMaintenanceDate returns the date of the next maintenance task of a volume
+// Volumes on which the task has never run are spread over the interval after the manager start.
+func (m *Manager) getNextMaintenanceDate(v *volume.Volume, task string, interval time.Duration) time.Time {
+	last := v.LastCheckDate
+	if task == taskPrune {
+		last = v.LastPruneDate
+	}
+	if last != "" {
+		lmd, err := time.Parse("2006-01-02 15:04:05", last)
+		if err == nil {
+			return lmd.Add(interval)
+		}
+	}
+	return m.startDate.Add(getVolumeOffset(v, interval))
+}
+
+func setNextMaintenanceDate(v *volume.Volume, task string, next time.Time) {
+	switch task {
+	case taskCheck:
+		v.NextCheckDate = next.Format("2006-01-02 15:04:05")
+	case taskPrune:
+		v.NextPruneDate = next.Format("2006-01-02 15:04:05")
+	}
+}
+
+// runMaintenanceAgent runs an agent performing a maintenance task on the repository of a volume
+func runMaintenanceAgent(ctx context.Context, m *Manager, v *volume.Volume, task string, args []string) (err error) {
+	run := m.startRun(v, task, volume.TriggerScheduled)
+	defer func() {
+		if err != nil && run.Status == "Running" {
+			m.setMaintenanceResult(v, run, task, "Failed")
+		}
+		m.endRun(ctx, run, err)
+	}()
+
+	useLogReceiver := false
+	if m.LogServer != "" {
+		useLogReceiver = true
+	}
+
+	cmd := []string{
+		"agent",
+		task,
+		"-r",
+		m.TargetURL + "/" + m.Orchestrator.GetPath(v) + "/" + v.RepoName,
+		"--engine",
+		m.getEngineName(),
+	}
+	cmd = append(cmd, args...)
+	if useLogReceiver {
+		cmd = append(cmd, []string{"--log.receiver", m.LogServer + "/" + task + "/" + v.ID + "/logs"}...)
+	}
+
+	log.WithFields(log.Fields{
+		"volume":   v.Name,
+		"hostname": v.Hostname,
+		"task":     task,
+	}).Debug("running maintenance...")
+
+	env, err := m.getAgentEnv(v)
+	if err != nil {
+		return
+	}
+
+	untrack := trackAgent(v)
+	_, output, err := m.Orchestrator.DeployAgent(
+		ctx,
+		m.AgentImage,
+		cmd,
+		env,
+		v,
+	)
+	untrack()
+	if err != nil {
+		v.Metrics.AgentDeploymentFailures.Inc()
+		err = fmt.Errorf("failed to deploy agent: %s", err)
+		return
+	}
+
+	if !useLogReceiver {
+		decodedOutput, err := base64.StdEncoding.DecodeString(strings.Replace(output, " ", "", -1))
+		if err != nil {
+			log.Errorf("failed to decode agent output of `%s` : %s -> `%s`", v.Name, err, strings.Replace(output, " ", "", -1))
+		} else {
+			var agentOutput utils.MsgFormat
+			err = json.Unmarshal(decodedOutput, &agentOutput)
+			if err != nil {
+				log.WithFields(log.Fields{
+					"volume":   v.Name,
+					"hostname": v.Hostname,
+				}).Warningf("failed to unmarshal agent output: %s -> `%s`", err, strings.TrimSpace(output))
+			}
+
+			m.updateMaintenanceLogs(v, task, agentOutput)
+		}
+	}
+
+	if run.Status == "Failed" {
+		err = fmt.Errorf("%s failed, see the volume logs", task)
+	}
+	return
+}
+
+// updateMaintenanceLogs records the output of a maintenance agent
+func (m *Manager) updateMaintenanceLogs(v *volume.Volume, task string, agentOutput utils.MsgFormat) {
+	run := m.getCurrentRun(v.ID)
+
+	status := "Failed"
+	if agentOutput.Type == "success" {
+		status = "Success"
+		if v.Logs == nil {
+			v.Logs = make(map[string]string)
+		}
+		for stepKey, stepValue := range agentOutput.Content.(map[string]interface{}) {
+			rc := int(stepValue.(map[string]interface{})["rc"].(float64))
+			if rc > 0 {
+				status = "Failed"
+			}
+			stdout, _ := base64.StdEncoding.DecodeString(stepValue.(map[string]interface{})["stdout"].(string))
+			if stepKey == task {
+				v.Logs[stepKey] = fmt.Sprintf("[%d] %s", rc, stdout)
+			}
+			if run != nil {
+				run.ExitCodes[stepKey] = rc
+			}
+
+			if stepKey == "stats" && rc == 0 {
+				var stats engine.Stats
+				if err := json.Unmarshal(stdout, &stats); err == nil {
+					v.Metrics.RepositorySize.Set(float64(stats.TotalSize))
+				}
+			}
+		}
+	}
+
+	m.setMaintenanceResult(v, run, task, status)
+	return
+}
+
+// setMaintenanceResult records the outcome of a maintenance task
+func (m *Manager) setMaintenanceResult(v *volume.Volume, run *volume.Run, task, status string) {
+	if run != nil {
+		run.Status = status
+	}
+	now := time.Now().UTC().Format("2006-01-02 15:04:05")
+	switch task {
+	case taskCheck:
+		v.LastCheckStatus = status
+		v.LastCheckDate = now
+		setCheckStatusMetric(v)
+	case taskPrune:
+		v.LastPruneStatus = status
+		v.LastPruneDate = now
+	}
+	saveVolumeState(m, v)
+	return
+}
+
+func setCheckStatusMetric(v *volume.Volume) {
+	switch v.LastCheckStatus {
+	case "Success":
+		v.Metrics.LastCheckStatus.Set(0.0)
+	case "Failed":
+		v.Metrics.LastCheckStatus.Set(1.0)
+	default:
+		v.Metrics.LastCheckStatus.Set(-1)
+	}
+}
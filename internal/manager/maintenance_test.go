@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/internal/store"
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// getMaintenanceSchedules
+func TestGetMaintenanceSchedules(t *testing.T) {
+	m := &Manager{}
+	assert.Equal(t, len(m.getMaintenanceSchedules()), 0)
+
+	m = &Manager{
+		CheckInterval:       24 * time.Hour,
+		CheckReadDataSubset: "10%",
+		PruneInterval:       7 * 24 * time.Hour,
+		PruneParallelCount:  2,
+	}
+	schedules := m.getMaintenanceSchedules()
+	assert.Equal(t, len(schedules), 2)
+	assert.Equal(t, schedules[0].task, taskCheck)
+	assert.Equal(t, schedules[0].parallelCount, 1)
+	assert.Equal(t, schedules[0].args, []string{"--read-data-subset", "10%"})
+	assert.Equal(t, schedules[1].task, taskPrune)
+	assert.Equal(t, schedules[1].parallelCount, 2)
+}
+
+// beginMaintenance
+func TestBeginMaintenance(t *testing.T) {
+	m := &Manager{}
+	v := &volume.Volume{}
+
+	assert.True(t, m.beginMaintenance(v, taskCheck))
+	assert.Equal(t, v.MaintenanceTask, taskCheck)
+	assert.False(t, m.beginMaintenance(v, taskPrune))
+	assert.False(t, m.beginBackup(v))
+
+	m.endMaintenance(v)
+	assert.True(t, m.beginBackup(v))
+	assert.True(t, v.BackingUp)
+	assert.False(t, m.beginMaintenance(v, taskPrune))
+	assert.Equal(t, v.MaintenanceTask, "")
+}
+
+// getNextMaintenanceDate
+func TestGetNextMaintenanceDate(t *testing.T) {
+	startDate := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	interval := 24 * time.Hour
+	m := &Manager{
+		startDate: startDate,
+	}
+
+	givenVolume := &volume.Volume{
+		ID:            "foo",
+		LastCheckDate: "2019-01-02 03:04:05",
+		LastPruneDate: "2019-01-05 03:04:05",
+	}
+	assert.Equal(t, m.getNextMaintenanceDate(givenVolume, taskCheck, interval), time.Date(2019, 1, 3, 3, 4, 5, 0, time.UTC))
+	assert.Equal(t, m.getNextMaintenanceDate(givenVolume, taskPrune, interval), time.Date(2019, 1, 6, 3, 4, 5, 0, time.UTC))
+
+	givenVolume = &volume.Volume{
+		ID: "foo",
+	}
+	next := m.getNextMaintenanceDate(givenVolume, taskPrune, interval)
+	assert.False(t, next.Before(startDate))
+	assert.True(t, next.Before(startDate.Add(interval)))
+	assert.Equal(t, m.getNextMaintenanceDate(givenVolume, taskPrune, interval), next)
+}
+
+// updateMaintenanceLogs
+func TestUpdateMaintenanceLogsCheck(t *testing.T) {
+	m := &Manager{
+		Store: store.NewMemoryStore(),
+	}
+	givenVolume := &volume.Volume{
+		ID:   "foo",
+		Name: "foo",
+	}
+	givenVolume.SetupMetrics()
+	defer givenVolume.CleanupMetrics()
+
+	agentOutput := utils.MsgFormat{
+		Type: "success",
+		Content: map[string]interface{}{
+			"check": map[string]interface{}{
+				"rc":     float64(1),
+				"stdout": base64.StdEncoding.EncodeToString([]byte("error: pack a1b2c3d4 is damaged")),
+			},
+		},
+	}
+
+	run := m.startRun(givenVolume, "check", volume.TriggerScheduled)
+	m.updateMaintenanceLogs(givenVolume, taskCheck, agentOutput)
+
+	assert.Equal(t, givenVolume.LastCheckStatus, "Failed")
+	assert.Equal(t, givenVolume.Logs["check"], "[1] error: pack a1b2c3d4 is damaged")
+	assert.Equal(t, run.Status, "Failed")
+	assert.Equal(t, run.ExitCodes["check"], 1)
+	assert.Equal(t, testutil.ToFloat64(givenVolume.Metrics.LastCheckStatus), float64(1))
+
+	state, found, err := m.Store.GetVolumeState("foo")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, state.LastCheckStatus, "Failed")
+	assert.Equal(t, state.LastCheckDate, givenVolume.LastCheckDate)
+}
+
+func TestUpdateMaintenanceLogsPrune(t *testing.T) {
+	m := &Manager{
+		Store: store.NewMemoryStore(),
+	}
+	givenVolume := &volume.Volume{
+		ID:   "foo",
+		Name: "foo",
+	}
+	givenVolume.SetupMetrics()
+	defer givenVolume.CleanupMetrics()
+
+	agentOutput := utils.MsgFormat{
+		Type: "success",
+		Content: map[string]interface{}{
+			"prune": map[string]interface{}{
+				"rc":     float64(0),
+				"stdout": base64.StdEncoding.EncodeToString([]byte("removed archive a1b2c3d4.tar.gz")),
+			},
+			"stats": map[string]interface{}{
+				"rc":     float64(0),
+				"stdout": base64.StdEncoding.EncodeToString([]byte(`{"total_size":4096,"total_file_count":3}`)),
+			},
+		},
+	}
+
+	run := m.startRun(givenVolume, "prune", volume.TriggerScheduled)
+	m.updateMaintenanceLogs(givenVolume, taskPrune, agentOutput)
+
+	assert.Equal(t, givenVolume.LastPruneStatus, "Success")
+	assert.Equal(t, givenVolume.LastCheckStatus, "")
+	assert.Equal(t, run.Status, "Success")
+	assert.Equal(t, testutil.ToFloat64(givenVolume.Metrics.RepositorySize), float64(4096))
+
+	state, found, err := m.Store.GetVolumeState("foo")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, state.LastPruneDate, givenVolume.LastPruneDate)
+}
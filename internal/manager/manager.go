@@ -1,16 +1,31 @@
 package manager
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/robfig/cron/v3"
 
+	"github.com/camptocamp/bivac/internal/engine"
+	"github.com/camptocamp/bivac/internal/store"
 	"github.com/camptocamp/bivac/internal/utils"
 	"github.com/camptocamp/bivac/pkg/orchestrators"
 	"github.com/camptocamp/bivac/pkg/volume"
 )
 
+// defaultBackupTimeout is the maximum duration of a backup when no timeout is configured
+const defaultBackupTimeout = 1 * time.Hour
+
 // Orchestrators groups the parameters of all supported orchestrators in one structure
 type Orchestrators struct {
 	Docker     orchestrators.DockerConfig
@@ -18,58 +33,228 @@ type Orchestrators struct {
 	Kubernetes orchestrators.KubernetesConfig
 }
 
+// Config groups the parameters of the manager, as read from the command line
+type Config struct {
+	ProvidersFile       string
+	TargetURL           string
+	LogServer           string
+	AgentImage          string
+	Engine              string
+	RetryCount          int
+	ParallelCount       int
+	ParallelPerTarget   int
+	ParallelTotal       int
+	RefreshRate         string
+	BackupInterval      string
+	BackupTimeout       string
+	BackupSpread        string
+	BackupWindow        string
+	Blackout            string
+	BackupExclude       string
+	BackupInclude       string
+	GracePeriod         string
+	CheckInterval       string
+	CheckReadDataSubset string
+	PruneInterval       string
+	PruneTimeout        string
+	PruneParallelCount  int
+	DBPath              string
+	HA                  bool
+}
+
 // Manager contains all informations used by the Bivac manager
 type Manager struct {
-	Orchestrator orchestrators.Orchestrator
-	Volumes      []*volume.Volume
-	Server       *Server
-	Providers    *Providers
-	TargetURL    string
-	RetryCount   int
-	LogServer    string
-	BuildInfo    utils.BuildInfo
-	AgentImage   string
-
-	backupSlots chan *volume.Volume
+	Orchestrator  orchestrators.Orchestrator
+	Volumes       []*volume.Volume
+	Server        *Server
+	Providers     *Providers
+	Store         store.Store
+	TargetURL     string
+	RetryCount    int
+	LogServer     string
+	BuildInfo     utils.BuildInfo
+	AgentImage    string
+	Engine        string
+	BackupTimeout time.Duration
+	RetryPolicy   RetryPolicy
+	BackupWindows []backupWindow
+	Blackouts     []backupWindow
+	BackupSpread  time.Duration
+	Excludes      []string
+	Includes      []string
+	ForgetArgs    string
+	Retention     volume.RetentionPolicy
+	CheckInterval time.Duration
+	PruneInterval time.Duration
+	PruneTimeout  time.Duration
+
+	CheckReadDataSubset string
+	PruneParallelCount  int
+
+	startDate    time.Time
+	queue        *backupQueue
+	slots        *agentSlots
+	runs         map[string]*volume.Run
+	runsMux      sync.Mutex
+	jobs         map[string]*job
+	jobsMux      sync.Mutex
+	identity     string
+	leaderCtx    context.Context
+	orphanAgents map[string]string
+	leaderMux    sync.Mutex
+	agents       sync.WaitGroup
+	shuttingDown bool
+	shutdownMux  sync.Mutex
+	tasksMux     sync.Mutex
+
+	credentials    map[string]cachedCredentials
+	credentialsMux sync.Mutex
 }
 
 // Start starts a Bivac manager which handle backups management
-func Start(buildInfo utils.BuildInfo, o orchestrators.Orchestrator, s Server, volumeFilters volume.Filters, providersFile, targetURL, logServer, agentImage string, retryCount, parallelCount int, refreshRate, backupInterval string) (err error) {
-	p, err := LoadProviders(providersFile)
+func Start(buildInfo utils.BuildInfo, o orchestrators.Orchestrator, s Server, volumeFilters volume.Filters, c Config) (err error) {
+	p, err := LoadProviders(c.ProvidersFile)
 	if err != nil {
 		err = fmt.Errorf("failed to read providers file: %s", err)
 		return
 	}
 
-	refreshInterval, err := time.ParseDuration(refreshRate)
+	refreshInterval, err := time.ParseDuration(c.RefreshRate)
 	if err != nil {
 		err = fmt.Errorf("failed to parse refresh time: %s", err)
 		return
 	}
 
-	backupInt, err := time.ParseDuration(backupInterval)
+	backupInt, err := time.ParseDuration(c.BackupInterval)
 	if err != nil {
 		err = fmt.Errorf("failed to parse backup interval: %s", err)
 		return
 	}
 
-	m := &Manager{
-		Orchestrator: o,
-		Server:       &s,
-		Providers:    &p,
-		TargetURL:    targetURL,
-		RetryCount:   retryCount,
-		LogServer:    logServer,
-		BuildInfo:    buildInfo,
-		AgentImage:   agentImage,
+	backupTo, err := time.ParseDuration(c.BackupTimeout)
+	if err != nil {
+		err = fmt.Errorf("failed to parse backup timeout: %s", err)
+		return
+	}
+
+	backupSpr, err := time.ParseDuration(c.BackupSpread)
+	if err != nil {
+		err = fmt.Errorf("failed to parse backup spread: %s", err)
+		return
+	}
+
+	backupWindows, err := parseBackupWindows(c.BackupWindow)
+	if err != nil {
+		err = fmt.Errorf("failed to parse backup window: %s", err)
+		return
+	}
+
+	blackouts, err := parseBackupWindows(c.Blackout)
+	if err != nil {
+		err = fmt.Errorf("failed to parse blackout periods: %s", err)
+		return
+	}
+
+	checkInt, err := time.ParseDuration(c.CheckInterval)
+	if err != nil {
+		err = fmt.Errorf("failed to parse check interval: %s", err)
+		return
+	}
+
+	pruneInt, err := time.ParseDuration(c.PruneInterval)
+	if err != nil {
+		err = fmt.Errorf("failed to parse prune interval: %s", err)
+		return
+	}
 
-		backupSlots: make(chan *volume.Volume, 100),
+	pruneTo, err := time.ParseDuration(c.PruneTimeout)
+	if err != nil {
+		err = fmt.Errorf("failed to parse prune timeout: %s", err)
+		return
 	}
 
-	// Catch orphan agents
-	orphanAgents, err := m.Orchestrator.RetrieveOrphanAgents()
+	shutdownGracePeriod, err := time.ParseDuration(c.GracePeriod)
 	if err != nil {
-		log.Errorf("failed to retrieve orphan agents: %s", err)
+		err = fmt.Errorf("failed to parse shutdown grace period: %s", err)
+		return
+	}
+
+	// The global retention policy is overridden by the retention options of the volumes
+	forgetArgs := os.Getenv("RESTIC_FORGET_ARGS")
+	retention, err := engine.ParseRetentionPolicy(forgetArgs)
+	if err != nil {
+		log.Errorf("failed to parse global retention policy: %s", err)
+	}
+
+	// Fail early instead of in each agent
+	if _, err = engine.NewEngine(c.Engine, c.TargetURL); err != nil {
+		err = fmt.Errorf("failed to get engine: %s", err)
+		return
+	}
+
+	// The agent pods do not mount the local targets, the backups would be lost with them
+	if o.GetName() == "kubernetes" && engine.IsLocalTarget(c.TargetURL) {
+		err = fmt.Errorf("local target `%s' is not supported on Kubernetes", c.TargetURL)
+		return
+	}
+
+	st, err := store.NewStore(c.DBPath)
+	if err != nil {
+		err = fmt.Errorf("failed to open state store: %s", err)
+		return
+	}
+	defer st.Close()
+	// Each manager has its own database, the state of the volumes is shared with the next leader
+	if c.HA {
+		st = store.NewSharedStore(st, o)
+	}
+
+	m := &Manager{
+		Orchestrator:  o,
+		Server:        &s,
+		Providers:     &p,
+		Store:         st,
+		TargetURL:     c.TargetURL,
+		RetryCount:    c.RetryCount,
+		LogServer:     c.LogServer,
+		BuildInfo:     buildInfo,
+		AgentImage:    c.AgentImage,
+		Engine:        c.Engine,
+		BackupTimeout: backupTo,
+		RetryPolicy:   DefaultRetryPolicy,
+		BackupWindows: backupWindows,
+		Blackouts:     blackouts,
+		BackupSpread:  backupSpr,
+		Excludes:      splitPatterns(c.BackupExclude),
+		Includes:      splitPatterns(c.BackupInclude),
+		ForgetArgs:    forgetArgs,
+		Retention:     retention,
+		CheckInterval: checkInt,
+		PruneInterval: pruneInt,
+		PruneTimeout:  pruneTo,
+
+		CheckReadDataSubset: c.CheckReadDataSubset,
+		PruneParallelCount:  c.PruneParallelCount,
+
+		startDate: time.Now().UTC(),
+		queue:     newBackupQueue(),
+		runs:      make(map[string]*volume.Run),
+		jobs:      make(map[string]*job),
+	}
+	m.slots = newAgentSlots(c.ParallelCount, c.ParallelPerTarget, c.ParallelTotal, m.getTargetKey)
+
+	// Agents are stopped when the leadership is lost or once the shutdown grace period is exceeded
+	agentsCtx, stopAgents := context.WithCancel(context.Background())
+	defer stopAgents()
+
+	if c.HA {
+		err = m.startLeaderElection(agentsCtx)
+		if err != nil {
+			err = fmt.Errorf("failed to start leader election: %s", err)
+			return
+		}
+	} else {
+		m.onElected(agentsCtx)
 	}
 
 	// Manage volumes
@@ -83,18 +268,53 @@ func Start(buildInfo utils.BuildInfo, o orchestrators.Orchestrator, s Server, vo
 				log.Errorf("failed to retrieve volumes: %s", err)
 			}
 
+			// Followers serve the state updated by the leader
+			if !m.isLeader() {
+				reloadVolumeStates(m)
+			}
+
+			// Volumes which have disappeared are not backed up
+			m.queue.retain(m.Volumes)
+
 			for _, v := range m.Volumes {
-				if val, ok := orphanAgents[v.ID]; ok {
-					v.BackingUp = true
-					go m.attachOrphanAgent(val, v)
-					delete(orphanAgents, val)
+				leaderCtx := m.getLeaderContext()
+				if leaderCtx != nil && !m.isShuttingDown() {
+					if containerID, ok := m.takeOrphanAgent(v.ID); ok && m.beginAgent() {
+						m.setBackingUp(v, true)
+						go func(containerID string, v *volume.Volume) {
+							defer m.endAgent()
+							m.attachOrphanAgent(leaderCtx, containerID, v)
+						}(containerID, v)
+					}
+				}
+
+				next, err := getNextBackupDate(v, backupInt)
+				// Avoid starting all due backups at once after a restart
+				staggeredStart := m.getStaggeredStartDate(v)
+				if next.Before(staggeredStart) {
+					next = staggeredStart
+				}
+				if err == nil && !next.IsZero() {
+					v.NextBackupDate = next.Format("2006-01-02 15:04:05")
+				} else {
+					v.NextBackupDate = ""
+				}
+
+				// Only the leader schedules backups
+				if leaderCtx == nil || m.isShuttingDown() || !isBackupNeeded(v, backupInt) {
+					continue
 				}
 
-				if !isBackupNeeded(v, backupInt) {
+				if !m.isInBackupWindow(v, time.Now()) {
+					log.WithFields(log.Fields{
+						"volume":   v.Name,
+						"hostname": v.Hostname,
+					}).Debug("Backup postponed until the backup window.")
 					continue
 				}
 
-				m.backupSlots <- v
+				// Staggered volumes wait in the queue until their start date
+				m.queue.push(v, next)
 			}
 
 			time.Sleep(refreshInterval)
@@ -102,90 +322,168 @@ func Start(buildInfo utils.BuildInfo, o orchestrators.Orchestrator, s Server, vo
 	}(m, volumeFilters)
 
 	// Manage backups
-	go func(m *Manager, parallelCount int) {
-		slots := make(map[string](chan bool))
-
+	go func(m *Manager) {
 		log.Infof("Starting backup manager...")
 
 		for {
-			v := <-m.backupSlots
-			if _, ok := slots[v.HostBind]; !ok {
-				slots[v.HostBind] = make(chan bool, parallelCount)
+			// Volumes stay in the queue until they are due and a slot is available
+			qv := m.queue.pop(m.slots.acquire)
+			if qv == nil {
+				select {
+				case <-m.queue.notify:
+				case <-m.queue.dueTimer():
+				}
+				continue
+			}
+			v := qv.volume
+
+			// The window may have closed while the volume was waiting in the queue
+			if !m.isInBackupWindow(v, time.Now()) {
+				log.WithFields(log.Fields{
+					"volume":   v.Name,
+					"hostname": v.Hostname,
+				}).Debug("Backup postponed until the backup window.")
+				m.releaseSlot(v)
+				continue
 			}
-			select {
-			case slots[v.HostBind] <- true:
-			default:
+
+			leaderCtx := m.getLeaderContext()
+			if leaderCtx == nil || !m.beginAgent() {
+				m.slots.release(v)
 				continue
 			}
+
 			if ok, _ := m.Orchestrator.IsNodeAvailable(v.HostBind); !ok && v.HostBind != "unbound" && m.Orchestrator.GetName() == "cattle" {
 				log.WithFields(log.Fields{
 					"node": v.HostBind,
 				}).Warning("Node unavailable.")
-				<-slots[v.HostBind]
+				m.slots.release(v)
+				m.endAgent()
 				continue
 			}
 
-			go func(v *volume.Volume) {
-				var timedout bool
-				tearDown := make(chan bool)
+			// A maintenance task may have started while the volume was waiting in the queue
+			if !m.beginBackup(v) {
+				log.WithFields(log.Fields{
+					"volume":   v.Name,
+					"hostname": v.Hostname,
+				}).Debug("Backup postponed until the end of the maintenance.")
+				m.releaseSlot(v)
+				m.endAgent()
+				continue
+			}
 
+			go func(v *volume.Volume) {
 				log.WithFields(log.Fields{
 					"volume":   v.Name,
 					"hostname": v.Hostname,
 				}).Debugf("Backing up volume.")
 				defer func() {
-					if !timedout {
-						tearDown <- true
-						<-slots[v.HostBind]
-					}
+					m.releaseSlot(v)
+					m.endAgent()
 				}()
 
-				// Workaround which avoid a stucked backup to block the whole backup process
-				// If the backup process takes more than one hour,
-				// the backup slot is released.
-				go func() {
-					timeout := time.After(1 * time.Hour)
-					select {
-					case <-tearDown:
-						return
-					case <-timeout:
-						timedout = true
-						<-slots[v.HostBind]
-					}
-				}()
+				// A stuck agent is removed once the timeout is reached or if the leadership is lost
+				ctx, cancel := context.WithTimeout(leaderCtx, m.getBackupTimeout(v))
+				defer cancel()
 
-				err = nil
-				for i := 0; i <= m.RetryCount; i++ {
-					err = backupVolume(m, v, false)
-					if err != nil {
+				var err error
+				for i := 0; ; i++ {
+					err = backupVolume(ctx, m, v, false, volume.TriggerScheduled)
+					if ctx.Err() != nil {
 						log.WithFields(log.Fields{
 							"volume":   v.Name,
 							"hostname": v.Hostname,
-							"try":      i + 1,
-						}).Errorf("failed to backup volume: %s", err)
+						}).Errorf("backup interrupted: %s", ctx.Err())
+						break
+					}
+					if err == nil {
+						break
+					}
+
+					kind := failureKind(err)
+					log.WithFields(log.Fields{
+						"volume":   v.Name,
+						"hostname": v.Hostname,
+						"try":      i + 1,
+						"failure":  kind,
+					}).Errorf("failed to backup volume: %s", err)
+
+					// Permanent failures wait for the next schedule
+					if !isTransientFailure(kind) || i >= m.RetryCount {
+						break
+					}
+					v.Metrics.BackupRetries.Inc()
 
-						time.Sleep(2 * time.Second)
-					} else {
+					select {
+					case <-ctx.Done():
+					case <-time.After(m.RetryPolicy.Backoff(i)):
+					}
+					if ctx.Err() != nil {
+						break
+					}
+					if !m.isInBackupWindow(v, time.Now()) {
+						log.WithFields(log.Fields{
+							"volume":   v.Name,
+							"hostname": v.Hostname,
+						}).Debug("Retry postponed until the backup window.")
 						break
 					}
 				}
+				if err != nil && ctx.Err() == nil {
+					m.countBackupFailure(v)
+				}
 			}(v)
 		}
-	}(m, parallelCount)
+	}(m)
+
+	// Manage repository maintenance
+	for _, schedule := range m.getMaintenanceSchedules() {
+		go m.manageMaintenance(schedule, refreshInterval)
+	}
 
 	// Manage API server
-	m.StartServer()
+	srv, serverErrs := m.StartServer()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err = <-serverErrs:
+		err = fmt.Errorf("failed to run API server: %s", err)
+		return
+	case sig := <-signals:
+		log.Infof("Received %s, shutting down...", sig)
+	}
 
+	m.shutdown(shutdownGracePeriod, stopAgents, srv)
 	return
 }
 
 func isBackupNeeded(v *volume.Volume, backupInt time.Duration) bool {
-	if v.BackingUp {
+	// Backups are postponed until the end of the maintenance as they would wait for the repository lock
+	if v.BackingUp || v.MaintenanceTask != "" {
 		return false
 	}
 
+	next, err := getNextBackupDate(v, backupInt)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"volume":   v.Name,
+			"hostname": v.Hostname,
+		}).Errorf("failed to compute next backup date of volume `%s': %s", v.Name, err)
+		return false
+	}
+
+	return !next.After(time.Now().UTC())
+}
+
+// getNextBackupDate returns the date when the volume should be backed up.
+// The volume's cron schedule is used if defined, otherwise the global backup interval.
+// A zero date is returned if the volume has never been backed up.
+func getNextBackupDate(v *volume.Volume, backupInt time.Duration) (next time.Time, err error) {
 	if v.LastBackupDate == "" {
-		return true
+		return
 	}
 
 	var dateRef string
@@ -197,21 +495,180 @@ func isBackupNeeded(v *volume.Volume, backupInt time.Duration) bool {
 
 	lbd, err := time.Parse("2006-01-02 15:04:05", dateRef)
 	if err != nil {
-		log.WithFields(log.Fields{
-			"volume":   v.Name,
-			"hostname": v.Hostname,
-		}).Errorf("failed to parse backup date of volume `%s': %s", v.Name, err)
-		return false
+		err = fmt.Errorf("failed to parse backup date: %s", err)
+		return
+	}
+
+	next = lbd.Add(backupInt)
+	if v.Schedule != "" {
+		var schedule cron.Schedule
+		schedule, err = cron.ParseStandard(v.Schedule)
+		if err != nil {
+			err = fmt.Errorf("failed to parse schedule `%s': %s", v.Schedule, err)
+			return
+		}
+		next = schedule.Next(lbd)
+	}
+
+	// Failed backups are retried sooner, unless the failure is permanent
+	failed := v.LastBackupStatus == "Failed" || v.LastBackupStatus == "Cancelled" || v.LastBackupStatus == "TimedOut"
+	if failed && !isPermanentFailure(v.LastFailureKind) {
+		retry := lbd.Add(rescheduleRetryPolicy.Backoff(v.ConsecutiveFailures - 1))
+		if retry.Before(next) {
+			next = retry
+		}
+	}
+	return
+}
+
+// GetQueue returns the volumes waiting for a backup
+func (m *Manager) GetQueue() []volume.QueueEntry {
+	if m.queue == nil {
+		return []volume.QueueEntry{}
+	}
+	return m.queue.entries()
+}
+
+// getStaggeredStartDate returns the date before which the volume can't be backed up after the manager start.
+// Volumes are spread over the spread window using an offset derived from their ID.
+func (m *Manager) getStaggeredStartDate(v *volume.Volume) time.Time {
+	if m.BackupSpread <= 0 {
+		return time.Time{}
+	}
+
+	return m.startDate.Add(getVolumeOffset(v, m.BackupSpread))
+}
+
+// getVolumeOffset returns an offset in [0, window) derived from the volume ID
+func getVolumeOffset(v *volume.Volume, window time.Duration) time.Duration {
+	if window <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(v.ID))
+	return time.Duration(h.Sum64() % uint64(window))
+}
+
+// getEngineName returns the name of the backup engine run by the agents
+func (m *Manager) getEngineName() string {
+	if m.Engine == "" {
+		return "restic"
+	}
+	return m.Engine
+}
+
+// credentialsCacheTTL is how long the repository credentials of a volume are reused before being resolved again
+const credentialsCacheTTL = 10 * time.Minute
+
+type cachedCredentials struct {
+	credentials map[string]string
+	date        time.Time
+}
+
+// getCredentials returns the repository credentials of the volume
+// They are cached so that the orchestrator is not queried each time the repository is accessed.
+func (m *Manager) getCredentials(v *volume.Volume) (credentials map[string]string, err error) {
+	m.credentialsMux.Lock()
+	defer m.credentialsMux.Unlock()
+
+	if c, ok := m.credentials[v.ID]; ok && time.Since(c.date) < credentialsCacheTTL {
+		return c.credentials, nil
+	}
+
+	credentials, err = m.Orchestrator.GetCredentials(v)
+	if err != nil {
+		err = fmt.Errorf("failed to get repository credentials: %s", err)
+		return
+	}
+	if m.credentials == nil {
+		m.credentials = make(map[string]cachedCredentials)
+	}
+	m.credentials[v.ID] = cachedCredentials{
+		credentials: credentials,
+		date:        time.Now(),
+	}
+	return
+}
+
+// getAgentEnv returns the environment of the agents working on a volume
+// The repository credentials of the volume replace the ones of the manager for the same backend
+// and the --keep-* options of RESTIC_FORGET_ARGS are replaced by the retention policy of the volume, if it sets one.
+// --prune is removed from RESTIC_FORGET_ARGS when the prune maintenance is enabled.
+func (m *Manager) getAgentEnv(v *volume.Volume) (env []string, err error) {
+	credentials, err := m.getCredentials(v)
+	if err != nil {
+		return
+	}
+	overrides := make(map[string]string)
+	for key, value := range credentials {
+		overrides[key] = value
+	}
+	forgetArgs := m.ForgetArgs
+	if v.Retention != nil && v.Retention.Source == volume.RetentionSourceVolume {
+		forgetArgs = engine.OverrideRetentionArgs(forgetArgs, *v.Retention)
+	}
+	// Unreferenced data are removed by the prune maintenance, out of the backup path
+	if m.PruneInterval > 0 {
+		forgetArgs = engine.RemovePruneArg(forgetArgs)
+	}
+	if forgetArgs != m.ForgetArgs {
+		overrides["RESTIC_FORGET_ARGS"] = forgetArgs
+	}
+
+	// The global credentials of a backend must not be mixed with the ones of the volume, e.g. the keys of another bucket
+	backends := make(map[string]bool)
+	for key := range credentials {
+		backends[orchestrators.GetCredentialBackend(key)] = true
+	}
+	for _, e := range os.Environ() {
+		key := strings.SplitN(e, "=", 2)[0]
+		if _, ok := overrides[key]; ok {
+			continue
+		}
+		if backends[orchestrators.GetCredentialBackend(key)] {
+			continue
+		}
+		env = append(env, e)
+	}
+
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		env = append(env, key+"="+overrides[key])
 	}
+	return
+}
 
-	if lbd.Add(time.Hour).Before(time.Now().UTC()) && v.LastBackupStatus == "Failed" {
-		return true
+// newEngine returns the engine working on the repository of a volume, with the volume's credentials
+func (m *Manager) newEngine(v *volume.Volume) (e engine.Engine, err error) {
+	env, err := m.getAgentEnv(v)
+	if err != nil {
+		return
 	}
+	return engine.NewEngineWithEnv(m.getEngineName(), m.TargetURL+"/"+m.Orchestrator.GetPath(v)+"/"+v.RepoName, env)
+}
+
+// getTargetKey identifies the backend and namespace where the volume is backed up.
+// It is used to limit the load on a same backend.
+func (m *Manager) getTargetKey(v *volume.Volume) string {
+	return m.TargetURL + "/" + v.Namespace
+}
 
-	if lbd.Add(backupInt).Before(time.Now().UTC()) {
-		return true
+// getBackupTimeout returns the maximum duration of a backup of the volume
+func (m *Manager) getBackupTimeout(v *volume.Volume) time.Duration {
+	if v.BackupTimeout != "" {
+		if timeout, err := time.ParseDuration(v.BackupTimeout); err == nil {
+			return timeout
+		}
+	}
+	if m.BackupTimeout > 0 {
+		return m.BackupTimeout
 	}
-	return false
+	return defaultBackupTimeout
 }
 
 // GetOrchestrator returns an orchestrator interface based on the name you specified or on the orchestrator Bivac is running on
@@ -249,15 +706,37 @@ func GetOrchestrator(name string, orchs Orchestrators) (o orchestrators.Orchestr
 	return
 }
 
+// getVolume returns a managed volume based on its ID
+func (m *Manager) getVolume(volumeID string) *volume.Volume {
+	for _, v := range m.Volumes {
+		if v.ID == volumeID {
+			return v
+		}
+	}
+	return nil
+}
+
 // BackupVolume does a backup of a volume
-func (m *Manager) BackupVolume(volumeID string, force bool) (err error) {
+// The agent is removed if the context is done before the end of the backup.
+func (m *Manager) BackupVolume(ctx context.Context, volumeID string, force bool) (err error) {
 	for _, v := range m.Volumes {
 		if v.ID == volumeID {
 			log.WithFields(log.Fields{
 				"volume":   v.Name,
 				"hostname": v.Hostname,
 			}).Debug("Backup manually requested.")
-			err = backupVolume(m, v, force)
+			err = m.slots.wait(ctx, v)
+			if err != nil {
+				err = fmt.Errorf("failed to wait for an agent slot: %s", err)
+				return
+			}
+			backupCtx, cancel := context.WithTimeout(ctx, m.getBackupTimeout(v))
+			err = backupVolume(backupCtx, m, v, force, volume.TriggerManual)
+			m.releaseSlot(v)
+			if err != nil && backupCtx.Err() == nil {
+				m.countBackupFailure(v)
+			}
+			cancel()
 			if err != nil {
 				err = fmt.Errorf("failed to backup volume: %s", err)
 				return
@@ -267,11 +746,23 @@ func (m *Manager) BackupVolume(volumeID string, force bool) (err error) {
 	return
 }
 
+// releaseSlot frees the agent slot used by the volume
+// and wakes up the volumes waiting in the queue
+func (m *Manager) releaseSlot(v *volume.Volume) {
+	m.slots.release(v)
+	m.queue.wakeUp()
+	return
+}
+
 // RestoreVolume does a restore of a volume
+// Only the paths matching includes, if any, and not matching excludes are restored.
 func (m *Manager) RestoreVolume(
+	ctx context.Context,
 	volumeID string,
 	force bool,
 	snapshotName string,
+	includes,
+	excludes []string,
 ) (err error) {
 	for _, v := range m.Volumes {
 		if v.ID == volumeID {
@@ -279,7 +770,13 @@ func (m *Manager) RestoreVolume(
 				"volume":   v.Name,
 				"hostname": v.Hostname,
 			}).Debug("Restore manually requested.")
-			err = restoreVolume(m, v, force, snapshotName)
+			err = m.slots.wait(ctx, v)
+			if err != nil {
+				err = fmt.Errorf("failed to wait for an agent slot: %s", err)
+				return
+			}
+			err = restoreVolume(ctx, m, v, force, snapshotName, includes, excludes)
+			m.releaseSlot(v)
 			if err != nil {
 				err = fmt.Errorf(
 					"failed to restore volume: %s",
@@ -302,6 +799,8 @@ func (m *Manager) GetInformations() (informations map[string]string) {
 		"orchestrator":   m.Orchestrator.GetName(),
 		"address":        m.Server.Address,
 		"volumes_count":  fmt.Sprintf("%d", len(m.Volumes)),
+		"queue_depth":    fmt.Sprintf("%d", len(m.GetQueue())),
+		"leader":         strconv.FormatBool(m.isLeader()),
 	}
 	return
 }
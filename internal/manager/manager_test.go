@@ -39,3 +39,100 @@ func TestIsBackupNeededBackupIntervalStatusFailed(t *testing.T) {
 	h, _ = time.ParseDuration("12h")
 	assert.Equal(t, isBackupNeeded(givenVolume, h), true)
 }
+
+func TestIsBackupNeededSchedule(t *testing.T) {
+	givenVolume := &volume.Volume{
+		BackingUp:        false,
+		LastBackupDate:   time.Now().UTC().Add(time.Hour * -2).Format("2006-01-02 15:04:05"),
+		LastBackupStatus: "Success",
+		Name:             "foo",
+		Hostname:         "bar",
+	}
+
+	h, _ := time.ParseDuration("23h")
+	givenVolume.Schedule = "* * * * *"
+	assert.Equal(t, isBackupNeeded(givenVolume, h), true)
+	givenVolume.Schedule = "0 0 1 1 *"
+	assert.Equal(t, isBackupNeeded(givenVolume, h), false)
+}
+
+// getNextBackupDate
+func TestGetNextBackupDate(t *testing.T) {
+	testCases := []struct {
+		givenVolume  *volume.Volume
+		expectedDate string
+	}{
+		{
+			&volume.Volume{},
+			"0001-01-01 00:00:00",
+		},
+		{
+			&volume.Volume{
+				LastBackupDate:   "2020-01-01 10:30:00",
+				LastBackupStatus: "Success",
+			},
+			"2020-01-02 09:30:00",
+		},
+		{
+			&volume.Volume{
+				LastBackupDate:   "2020-01-01 10:30:00",
+				LastBackupStatus: "Success",
+				Schedule:         "0 */4 * * *",
+			},
+			"2020-01-01 12:00:00",
+		},
+		{
+			&volume.Volume{
+				LastBackupDate:   "2020-01-01 10:30:00",
+				LastBackupStatus: "Failed",
+				Schedule:         "0 0 * * *",
+			},
+			"2020-01-01 11:30:00",
+		},
+	}
+
+	for _, testCase := range testCases {
+		next, err := getNextBackupDate(testCase.givenVolume, 23*time.Hour)
+		assert.Nil(t, err)
+		assert.Equal(t, next.Format("2006-01-02 15:04:05"), testCase.expectedDate)
+	}
+}
+
+func TestGetNextBackupDateInvalidSchedule(t *testing.T) {
+	givenVolume := &volume.Volume{
+		LastBackupDate: "2020-01-01 10:30:00",
+		Schedule:       "foo",
+	}
+
+	_, err := getNextBackupDate(givenVolume, 23*time.Hour)
+	assert.NotNil(t, err)
+}
+
+// getBackupTimeout
+func TestGetBackupTimeout(t *testing.T) {
+	m := &Manager{}
+	assert.Equal(t, m.getBackupTimeout(&volume.Volume{}), defaultBackupTimeout)
+
+	m.BackupTimeout = 2 * time.Hour
+	assert.Equal(t, m.getBackupTimeout(&volume.Volume{}), 2*time.Hour)
+	assert.Equal(t, m.getBackupTimeout(&volume.Volume{BackupTimeout: "10m"}), 10*time.Minute)
+}
+
+// getStaggeredStartDate
+func TestGetStaggeredStartDate(t *testing.T) {
+	startDate := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	m := &Manager{
+		startDate: startDate,
+	}
+	givenVolume := &volume.Volume{ID: "foo"}
+
+	assert.True(t, m.getStaggeredStartDate(givenVolume).IsZero())
+
+	m.BackupSpread = time.Hour
+	date := m.getStaggeredStartDate(givenVolume)
+	assert.False(t, date.Before(startDate))
+	assert.True(t, date.Before(startDate.Add(time.Hour)))
+	// The offset only depends on the volume ID
+	assert.Equal(t, m.getStaggeredStartDate(&volume.Volume{ID: "foo"}), date)
+	assert.NotEqual(t, m.getStaggeredStartDate(&volume.Volume{ID: "bar"}), date)
+}
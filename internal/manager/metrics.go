@@ -0,0 +1,37 @@
+package manager
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+var runningAgentsMetric = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "bivac",
+	Name:      "running_agents",
+	Help:      "Count of agents running on each node",
+}, []string{"node"})
+
+var orphanAgentsRecoveredMetric = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "bivac",
+	Name:      "orphan_agents_recovered_total",
+	Help:      "Count of orphan agents attached after a manager restart",
+})
+
+// trackAgent counts an agent running for a volume until the returned function is called
+func trackAgent(v *volume.Volume) (untrack func()) {
+	g := runningAgentsMetric.WithLabelValues(v.HostBind)
+	g.Inc()
+	return g.Dec
+}
+
+// observeRun records the duration of a finished run
+// Each attempt of a backup is a run, the failed and interrupted ones are told apart by their status.
+func observeRun(v *volume.Volume, run *volume.Run) {
+	switch run.Type {
+	case "backup":
+		v.Metrics.BackupDuration.WithLabelValues(run.Status).Observe(run.Duration.Seconds())
+	case "restore":
+		v.Metrics.RestoreDuration.WithLabelValues(run.Status).Observe(run.Duration.Seconds())
+	}
+}
@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// trackAgent
+func TestTrackAgent(t *testing.T) {
+	givenVolume := &volume.Volume{
+		HostBind: "node1",
+	}
+
+	untrack := trackAgent(givenVolume)
+	assert.Equal(t, testutil.ToFloat64(runningAgentsMetric.WithLabelValues("node1")), float64(1))
+	untrack()
+	assert.Equal(t, testutil.ToFloat64(runningAgentsMetric.WithLabelValues("node1")), float64(0))
+}
+
+// observeRun
+func TestObserveRun(t *testing.T) {
+	givenVolume := &volume.Volume{
+		ID:   "bar",
+		Name: "bar",
+	}
+	givenVolume.SetupMetrics()
+	defer givenVolume.CleanupMetrics()
+
+	observeRun(givenVolume, &volume.Run{Type: "backup", Status: "Success", Duration: time.Minute})
+	observeRun(givenVolume, &volume.Run{Type: "backup", Status: "Success", Duration: time.Hour})
+	observeRun(givenVolume, &volume.Run{Type: "backup", Status: "Failed", Duration: time.Second})
+	observeRun(givenVolume, &volume.Run{Type: "restore", Status: "Success", Duration: time.Minute})
+
+	assert.Equal(t, histogramCount(t, givenVolume.Metrics.BackupDuration.WithLabelValues("Success")), uint64(2))
+	assert.Equal(t, histogramCount(t, givenVolume.Metrics.BackupDuration.WithLabelValues("Failed")), uint64(1))
+	assert.Equal(t, histogramCount(t, givenVolume.Metrics.RestoreDuration.WithLabelValues("Success")), uint64(1))
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	m := &dto.Metric{}
+	err := o.(prometheus.Histogram).Write(m)
+	assert.Nil(t, err)
+	return m.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,257 @@
+package manager
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+var queueDepthMetric = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "bivac",
+	Name:      "queue_depth",
+	Help:      "Count of volumes waiting for a backup slot",
+})
+
+var queueWaitMetric = prometheus.NewHistogram(prometheus.HistogramOpts{
+	Namespace: "bivac",
+	Name:      "queue_wait_seconds",
+	Help:      "Time spent by volumes waiting for a backup slot",
+	Buckets:   []float64{1, 10, 60, 300, 900, 1800, 3600, 3 * 3600, 6 * 3600, 12 * 3600},
+})
+
+type queuedVolume struct {
+	volume.QueueEntry
+
+	volume *volume.Volume
+}
+
+// backupQueue stores the volumes waiting for a backup.
+// Volumes are ordered by priority, then from the most to the least overdue one.
+type backupQueue struct {
+	mux     sync.Mutex
+	volumes map[string]*queuedVolume
+	notify  chan bool
+}
+
+func newBackupQueue() *backupQueue {
+	return &backupQueue{
+		volumes: make(map[string]*queuedVolume),
+		notify:  make(chan bool, 1),
+	}
+}
+
+// push adds a volume to the queue or updates it if already queued
+func (q *backupQueue) push(v *volume.Volume, dueDate time.Time) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	qv, ok := q.volumes[v.ID]
+	if !ok {
+		qv = &queuedVolume{
+			volume: v,
+		}
+		qv.EnqueueDate = time.Now().UTC()
+		q.volumes[v.ID] = qv
+	}
+	qv.VolumeID = v.ID
+	qv.VolumeName = v.Name
+	qv.Hostname = v.Hostname
+	qv.Priority = v.Priority
+	qv.DueDate = dueDate
+	queueDepthMetric.Set(float64(len(q.volumes)))
+
+	q.wakeUp()
+	return
+}
+
+// pop removes and returns the first due volume accepted by the acquire function.
+// nil is returned if no volume can be backed up.
+func (q *backupQueue) pop(acquire func(v *volume.Volume) bool) *queuedVolume {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	now := time.Now().UTC()
+	for _, qv := range q.sorted() {
+		if qv.DueDate.After(now) || !acquire(qv.volume) {
+			continue
+		}
+		delete(q.volumes, qv.VolumeID)
+		queueDepthMetric.Set(float64(len(q.volumes)))
+		queueWaitMetric.Observe(time.Since(qv.EnqueueDate).Seconds())
+		return qv
+	}
+	return nil
+}
+
+// retain removes the queued volumes which are no longer managed
+func (q *backupQueue) retain(volumes []*volume.Volume) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	managed := make(map[string]bool)
+	for _, v := range volumes {
+		managed[v.ID] = true
+	}
+	for id := range q.volumes {
+		if !managed[id] {
+			delete(q.volumes, id)
+		}
+	}
+	queueDepthMetric.Set(float64(len(q.volumes)))
+	return
+}
+
+// dueTimer returns a channel notified once the first volume waiting for its due date may be backed up.
+// A nil channel is returned if no volume is waiting for its due date.
+func (q *backupQueue) dueTimer() <-chan time.Time {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	now := time.Now().UTC()
+	var first time.Time
+	for _, qv := range q.volumes {
+		if qv.DueDate.After(now) && (first.IsZero() || qv.DueDate.Before(first)) {
+			first = qv.DueDate
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+	return time.After(first.Sub(now))
+}
+
+// wakeUp notifies the backup manager that a volume may be backed up
+func (q *backupQueue) wakeUp() {
+	select {
+	case q.notify <- true:
+	default:
+	}
+}
+
+// entries returns the queue content in order
+func (q *backupQueue) entries() (entries []volume.QueueEntry) {
+	q.mux.Lock()
+	defer q.mux.Unlock()
+
+	entries = []volume.QueueEntry{}
+	for _, qv := range q.sorted() {
+		entry := qv.QueueEntry
+		entry.Wait = time.Since(entry.EnqueueDate)
+		entries = append(entries, entry)
+	}
+	return
+}
+
+func (q *backupQueue) sorted() (volumes []*queuedVolume) {
+	for _, qv := range q.volumes {
+		volumes = append(volumes, qv)
+	}
+	sort.SliceStable(volumes, func(i, j int) bool {
+		if volumes[i].Priority != volumes[j].Priority {
+			return volumes[i].Priority > volumes[j].Priority
+		}
+		if !volumes[i].DueDate.Equal(volumes[j].DueDate) {
+			return volumes[i].DueDate.Before(volumes[j].DueDate)
+		}
+		if !volumes[i].EnqueueDate.Equal(volumes[j].EnqueueDate) {
+			return volumes[i].EnqueueDate.Before(volumes[j].EnqueueDate)
+		}
+		return volumes[i].VolumeID < volumes[j].VolumeID
+	})
+	return
+}
+
+// agentSlots limits the count of agents running in parallel
+// on each host, on each target and in total.
+// A target or total limit of 0 disables the corresponding check,
+// no agent may run with a host limit of 0.
+type agentSlots struct {
+	mux       sync.Mutex
+	perHost   int
+	perTarget int
+	total     int
+	hosts     map[string]int
+	targets   map[string]int
+	running   int
+	targetKey func(v *volume.Volume) string
+	released  chan bool
+}
+
+func newAgentSlots(perHost, perTarget, total int, targetKey func(v *volume.Volume) string) *agentSlots {
+	return &agentSlots{
+		perHost:   perHost,
+		perTarget: perTarget,
+		total:     total,
+		hosts:     make(map[string]int),
+		targets:   make(map[string]int),
+		targetKey: targetKey,
+		released:  make(chan bool),
+	}
+}
+
+// acquire reserves a slot for the volume if one is available
+func (s *agentSlots) acquire(v *volume.Volume) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	target := s.targetKey(v)
+	if s.hosts[v.HostBind] >= s.perHost {
+		return false
+	}
+	if s.perTarget > 0 && s.targets[target] >= s.perTarget {
+		return false
+	}
+	if s.total > 0 && s.running >= s.total {
+		return false
+	}
+	s.hosts[v.HostBind]++
+	s.targets[target]++
+	s.running++
+	return true
+}
+
+// release frees the slot used by the volume
+func (s *agentSlots) release(v *volume.Volume) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	target := s.targetKey(v)
+	if s.hosts[v.HostBind] > 0 {
+		s.hosts[v.HostBind]--
+	}
+	if s.targets[target] > 0 {
+		s.targets[target]--
+	}
+	if s.running > 0 {
+		s.running--
+	}
+
+	// Wake up the agents waiting for a slot
+	close(s.released)
+	s.released = make(chan bool)
+}
+
+// wait reserves a slot for the volume, waiting for one to be released if needed
+func (s *agentSlots) wait(ctx context.Context, v *volume.Volume) (err error) {
+	for {
+		s.mux.Lock()
+		released := s.released
+		s.mux.Unlock()
+
+		if s.acquire(v) {
+			return
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
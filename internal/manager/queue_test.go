@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// backupQueue
+func TestBackupQueueOrder(t *testing.T) {
+	q := newBackupQueue()
+	now := time.Now().UTC()
+
+	q.push(&volume.Volume{ID: "bulk", HostBind: "node1"}, now.Add(-2*time.Hour))
+	q.push(&volume.Volume{ID: "recent", HostBind: "node1"}, now.Add(-1*time.Hour))
+	q.push(&volume.Volume{ID: "db", HostBind: "node1", Priority: 10}, now)
+	q.push(&volume.Volume{ID: "bulk", HostBind: "node1"}, now.Add(-2*time.Hour))
+
+	entries := q.entries()
+	assert.Equal(t, len(entries), 3)
+	assert.Equal(t, entries[0].VolumeID, "db")
+	assert.Equal(t, entries[1].VolumeID, "bulk")
+	assert.Equal(t, entries[2].VolumeID, "recent")
+}
+
+func TestBackupQueuePopSlots(t *testing.T) {
+	q := newBackupQueue()
+	slots := newAgentSlots(1, 0, 0, func(v *volume.Volume) string { return "" })
+	now := time.Now().UTC()
+
+	busy := &volume.Volume{ID: "busy", HostBind: "node1"}
+	assert.True(t, slots.acquire(busy))
+
+	q.push(&volume.Volume{ID: "foo", HostBind: "node1", Priority: 10}, now)
+	q.push(&volume.Volume{ID: "bar", HostBind: "node2"}, now)
+
+	// The volume whose node is busy is kept in the queue
+	qv := q.pop(slots.acquire)
+	assert.Equal(t, qv.VolumeID, "bar")
+	assert.Nil(t, q.pop(slots.acquire))
+	assert.Equal(t, len(q.entries()), 1)
+
+	slots.release(busy)
+	qv = q.pop(slots.acquire)
+	assert.Equal(t, qv.VolumeID, "foo")
+	assert.Equal(t, len(q.entries()), 0)
+}
+
+func TestBackupQueueDueDate(t *testing.T) {
+	q := newBackupQueue()
+	slots := newAgentSlots(1, 0, 0, func(v *volume.Volume) string { return "" })
+	now := time.Now().UTC()
+
+	assert.Nil(t, q.dueTimer())
+
+	// The staggered volume waits for its due date
+	q.push(&volume.Volume{ID: "foo", HostBind: "node1", Priority: 10}, now.Add(50*time.Millisecond))
+	assert.Nil(t, q.pop(slots.acquire))
+	assert.Equal(t, len(q.entries()), 1)
+
+	<-q.dueTimer()
+	qv := q.pop(slots.acquire)
+	assert.Equal(t, qv.VolumeID, "foo")
+	assert.Nil(t, q.dueTimer())
+}
+
+func TestBackupQueueRetain(t *testing.T) {
+	q := newBackupQueue()
+	now := time.Now().UTC()
+
+	foo := &volume.Volume{ID: "foo", HostBind: "node1"}
+	q.push(foo, now)
+	q.push(&volume.Volume{ID: "bar", HostBind: "node1"}, now)
+
+	q.retain([]*volume.Volume{foo})
+	entries := q.entries()
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].VolumeID, "foo")
+}
+
+// agentSlots
+func TestAgentSlotsLimits(t *testing.T) {
+	slots := newAgentSlots(2, 1, 2, func(v *volume.Volume) string { return v.Namespace })
+
+	foo := &volume.Volume{ID: "foo", HostBind: "node1", Namespace: "ns1"}
+	bar := &volume.Volume{ID: "bar", HostBind: "node1", Namespace: "ns1"}
+	baz := &volume.Volume{ID: "baz", HostBind: "node2", Namespace: "ns2"}
+	qux := &volume.Volume{ID: "qux", HostBind: "node3", Namespace: "ns3"}
+
+	assert.True(t, slots.acquire(foo))
+	// Same target
+	assert.False(t, slots.acquire(bar))
+	assert.True(t, slots.acquire(baz))
+	// Global limit
+	assert.False(t, slots.acquire(qux))
+
+	slots.release(foo)
+	assert.True(t, slots.acquire(qux))
+	assert.False(t, slots.acquire(bar))
+	slots.release(baz)
+	assert.True(t, slots.acquire(bar))
+}
+
+func TestAgentSlotsNoHostSlot(t *testing.T) {
+	slots := newAgentSlots(0, 0, 0, func(v *volume.Volume) string { return "" })
+
+	assert.False(t, slots.acquire(&volume.Volume{ID: "foo", HostBind: "node1"}))
+}
+
+func TestAgentSlotsWait(t *testing.T) {
+	slots := newAgentSlots(1, 0, 0, func(v *volume.Volume) string { return "" })
+
+	foo := &volume.Volume{ID: "foo", HostBind: "node1"}
+	bar := &volume.Volume{ID: "bar", HostBind: "node1"}
+	assert.True(t, slots.acquire(foo))
+
+	// The slot is never released
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, slots.wait(ctx, bar), context.DeadlineExceeded)
+
+	done := make(chan error)
+	go func() {
+		done <- slots.wait(context.Background(), bar)
+	}()
+	slots.release(foo)
+	assert.Nil(t, <-done)
+	assert.False(t, slots.acquire(foo))
+}
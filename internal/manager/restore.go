@@ -1,25 +1,33 @@
 package manager
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/camptocamp/bivac/internal/utils"
 	"github.com/camptocamp/bivac/pkg/volume"
-	"os"
 	"strings"
 	"time"
 )
 
 func restoreVolume(
+	ctx context.Context,
 	m *Manager,
 	v *volume.Volume,
 	force bool,
 	snapshotName string,
+	includes,
+	excludes []string,
 ) (err error) {
 	v.Mux.Lock()
 	defer v.Mux.Unlock()
+	run := m.startRun(v, "restore", volume.TriggerManual)
+	defer func() {
+		m.endRun(ctx, run, err)
+		observeRun(v, run)
+	}()
 	useLogReceiver := false
 	if m.LogServer != "" {
 		useLogReceiver = true
@@ -49,20 +57,37 @@ func restoreVolume(
 		snapshotName,
 		"--host",
 		m.Orchestrator.GetPath(v),
+		"--engine",
+		m.getEngineName(),
 	}
 	if force {
 		cmd = append(cmd, "--force")
 	}
+	for _, include := range includes {
+		cmd = append(cmd, "--include", include)
+	}
+	for _, exclude := range excludes {
+		cmd = append(cmd, "--exclude", exclude)
+	}
 	if useLogReceiver {
 		cmd = append(cmd, []string{"--log.receiver", m.LogServer + "/restore/" + v.ID + "/logs"}...)
 	}
+	env, err := m.getAgentEnv(v)
+	if err != nil {
+		return
+	}
+
+	untrack := trackAgent(v)
 	_, output, err := m.Orchestrator.DeployAgent(
+		ctx,
 		m.AgentImage,
 		cmd,
-		os.Environ(),
+		env,
 		v,
 	)
+	untrack()
 	if err != nil {
+		v.Metrics.AgentDeploymentFailures.Inc()
 		err = fmt.Errorf("failed to deploy agent: %s", err)
 		return
 	}
@@ -125,5 +150,6 @@ func (m *Manager) updateRestoreLogs(v *volume.Volume, agentOutput utils.MsgForma
 	}
 	v.LastBackupDate = time.Now().Format("2006-01-02 15:04:05")
 	v.Metrics.LastBackupDate.SetToCurrentTime()
+	saveVolumeState(m, v)
 	return
 }
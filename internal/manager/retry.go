@@ -0,0 +1,150 @@
+package manager
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// Kinds of backup failures
+const (
+	FailureRepositoryLocked = "RepositoryLocked"
+	FailureBackend          = "Backend"
+	FailureAgentDeployment  = "AgentDeployment"
+	FailurePreCommand       = "PreCommand"
+	FailureCredentials      = "Credentials"
+	FailureUnknown          = "Unknown"
+)
+
+// RetryPolicy defines the delay between two attempts of a failed backup
+type RetryPolicy struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	Multiplier      float64
+	// Jitter is the maximum random variation of the delay, as a fraction of it
+	Jitter float64
+}
+
+// DefaultRetryPolicy is used to retry transient failures of scheduled backups
+var DefaultRetryPolicy = RetryPolicy{
+	InitialInterval: 2 * time.Second,
+	MaxInterval:     2 * time.Minute,
+	Multiplier:      2,
+	Jitter:          0.2,
+}
+
+// rescheduleRetryPolicy is used to reschedule volumes whose retries have been exhausted
+var rescheduleRetryPolicy = RetryPolicy{
+	InitialInterval: 1 * time.Hour,
+	MaxInterval:     24 * time.Hour,
+	Multiplier:      2,
+}
+
+// Backoff returns the delay to wait after the given attempt, starting at 0
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 0 {
+		attempt = 0
+	}
+
+	d := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt))
+	if p.MaxInterval > 0 && d > float64(p.MaxInterval) {
+		d = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		d += d * p.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// backupFailure is an error whose cause has been identified
+type backupFailure struct {
+	kind string
+	err  error
+}
+
+func newBackupFailure(kind string, err error) *backupFailure {
+	return &backupFailure{
+		kind: kind,
+		err:  err,
+	}
+}
+
+func (f *backupFailure) Error() string {
+	return f.err.Error()
+}
+
+// failureKind returns the kind of a backup error
+func failureKind(err error) string {
+	if f, ok := err.(*backupFailure); ok {
+		return f.kind
+	}
+	return FailureUnknown
+}
+
+// isTransientFailure returns true if the backup can be retried immediately
+func isTransientFailure(kind string) bool {
+	switch kind {
+	case FailureRepositoryLocked, FailureBackend, FailureAgentDeployment:
+		return true
+	}
+	return false
+}
+
+// isPermanentFailure returns true if the backup must not be retried before its next schedule
+func isPermanentFailure(kind string) bool {
+	switch kind {
+	case FailurePreCommand, FailureCredentials:
+		return true
+	}
+	return false
+}
+
+var repositoryLockedPatterns = []string{
+	"repository is already locked",
+	"unable to create lock",
+}
+
+var backendPatterns = []string{
+	"connection refused",
+	"connection reset",
+	"no such host",
+	"i/o timeout",
+	"tls handshake timeout",
+	"temporary failure",
+	"network is unreachable",
+	"service unavailable",
+	"dial tcp",
+}
+
+// classifyAgentFailure guesses the cause of a failure reported by an agent
+func classifyAgentFailure(v *volume.Volume, agentOutput utils.MsgFormat) string {
+	var output string
+	if agentOutput.Type != "success" {
+		output, _ = agentOutput.Content.(string)
+	} else {
+		for _, logs := range v.Logs {
+			output += logs + "\n"
+		}
+	}
+	return classifyFailure(output)
+}
+
+// classifyFailure guesses the cause of a failure from its output
+func classifyFailure(output string) string {
+	output = strings.ToLower(output)
+	for _, pattern := range repositoryLockedPatterns {
+		if strings.Contains(output, pattern) {
+			return FailureRepositoryLocked
+		}
+	}
+	for _, pattern := range backendPatterns {
+		if strings.Contains(output, pattern) {
+			return FailureBackend
+		}
+	}
+	return FailureUnknown
+}
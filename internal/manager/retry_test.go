@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// Backoff
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: 2 * time.Second,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+
+	assert.Equal(t, policy.Backoff(0), 2*time.Second)
+	assert.Equal(t, policy.Backoff(1), 4*time.Second)
+	assert.Equal(t, policy.Backoff(2), 8*time.Second)
+	assert.Equal(t, policy.Backoff(3), 10*time.Second)
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{
+		InitialInterval: 10 * time.Second,
+		Multiplier:      2,
+		Jitter:          0.5,
+	}
+
+	for i := 0; i < 100; i++ {
+		d := policy.Backoff(0)
+		assert.True(t, d >= 5*time.Second && d <= 15*time.Second, fmt.Sprintf("unexpected backoff: %s", d))
+	}
+}
+
+// classifyFailure
+func TestClassifyFailure(t *testing.T) {
+	testCases := map[string]string{
+		"Fatal: unable to create lock in backend: repository is already locked by PID 12":      FailureRepositoryLocked,
+		"Fatal: unable to open config file: Get https://s3.example.com: dial tcp: i/o timeout": FailureBackend,
+		"Fatal: wrong password or no key found":                                                FailureUnknown,
+	}
+
+	for output, expected := range testCases {
+		assert.Equal(t, classifyFailure(output), expected)
+	}
+}
+
+// failureKind
+func TestFailureKind(t *testing.T) {
+	assert.Equal(t, failureKind(newBackupFailure(FailureAgentDeployment, errors.New("foo"))), FailureAgentDeployment)
+	assert.Equal(t, failureKind(errors.New("foo")), FailureUnknown)
+	assert.True(t, isTransientFailure(FailureRepositoryLocked))
+	assert.False(t, isTransientFailure(FailureUnknown))
+	assert.False(t, isTransientFailure(FailurePreCommand))
+	assert.True(t, isPermanentFailure(FailurePreCommand))
+	assert.True(t, isPermanentFailure(FailureCredentials))
+	assert.False(t, isPermanentFailure(FailureBackend))
+}
+
+// getNextBackupDate
+func TestGetNextBackupDateFailures(t *testing.T) {
+	// Transient and unknown failures are rescheduled an hour after the first failure,
+	// permanent ones wait for the next schedule
+	testCases := map[string]string{
+		FailureRepositoryLocked: "2020-01-01 11:30:00",
+		FailureBackend:          "2020-01-01 11:30:00",
+		FailureAgentDeployment:  "2020-01-01 11:30:00",
+		FailureUnknown:          "2020-01-01 11:30:00",
+		FailurePreCommand:       "2020-01-02 09:30:00",
+		FailureCredentials:      "2020-01-02 09:30:00",
+	}
+
+	for kind, expectedDate := range testCases {
+		givenVolume := &volume.Volume{
+			LastBackupDate:      "2020-01-01 10:30:00",
+			LastBackupStatus:    "Failed",
+			LastFailureKind:     kind,
+			ConsecutiveFailures: 1,
+		}
+		next, err := getNextBackupDate(givenVolume, 23*time.Hour)
+		assert.Nil(t, err)
+		assert.Equal(t, next.Format("2006-01-02 15:04:05"), expectedDate, kind)
+	}
+
+	// The delay grows with the consecutive failures
+	givenVolume := &volume.Volume{
+		LastBackupDate:      "2020-01-01 10:30:00",
+		LastBackupStatus:    "Failed",
+		LastFailureKind:     FailureBackend,
+		ConsecutiveFailures: 3,
+	}
+	next, err := getNextBackupDate(givenVolume, 23*time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, next.Format("2006-01-02 15:04:05"), "2020-01-01 14:30:00")
+}
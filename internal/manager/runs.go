@@ -0,0 +1,107 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// startRun records the beginning of a backup or a restore of a volume
+func (m *Manager) startRun(v *volume.Volume, runType, trigger string) (run *volume.Run) {
+	now := time.Now().UTC()
+	run = &volume.Run{
+		ID:         fmt.Sprintf("%s-%s", now.Format("20060102150405"), utils.GenerateRandomString(6)),
+		VolumeID:   v.ID,
+		VolumeName: v.Name,
+		Type:       runType,
+		Trigger:    trigger,
+		Status:     "Running",
+		StartDate:  now,
+		ExitCodes:  make(map[string]int),
+	}
+
+	m.runsMux.Lock()
+	if m.runs == nil {
+		m.runs = make(map[string]*volume.Run)
+	}
+	m.runs[v.ID] = run
+	m.runsMux.Unlock()
+
+	m.saveRun(run)
+	return
+}
+
+// getCurrentRun returns the run in progress on a volume
+func (m *Manager) getCurrentRun(volumeID string) *volume.Run {
+	m.runsMux.Lock()
+	defer m.runsMux.Unlock()
+
+	return m.runs[volumeID]
+}
+
+// endRun records the end of a run
+// The run is marked as cancelled or timed out if its context is done.
+func (m *Manager) endRun(ctx context.Context, run *volume.Run, err error) {
+	m.runsMux.Lock()
+	if m.runs[run.VolumeID] == run {
+		delete(m.runs, run.VolumeID)
+	}
+	m.runsMux.Unlock()
+
+	run.EndDate = time.Now().UTC()
+	run.Duration = run.EndDate.Sub(run.StartDate)
+	if ctx.Err() != nil {
+		run.Status = interruptedStatus(ctx.Err())
+		run.Error = ctx.Err().Error()
+	} else if err != nil {
+		run.Status = "Failed"
+		run.Error = err.Error()
+	} else if run.Status == "Running" {
+		// The agent never reported its output
+		run.Status = "Unknown"
+	}
+
+	m.saveRun(run)
+	return
+}
+
+// interruptedStatus returns the status of a run whose context is done
+func interruptedStatus(reason error) string {
+	if reason == context.DeadlineExceeded {
+		return "TimedOut"
+	}
+	return "Cancelled"
+}
+
+func (m *Manager) saveRun(run *volume.Run) {
+	if m.Store == nil {
+		return
+	}
+
+	err := m.Store.SaveRun(*run)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"volume": run.VolumeName,
+			"run":    run.ID,
+		}).Errorf("failed to save run: %s", err)
+	}
+	return
+}
+
+// GetRuns returns the backup and restore history of a volume
+func (m *Manager) GetRuns(volumeID string) (runs []volume.Run, err error) {
+	if m.Store == nil {
+		return
+	}
+
+	runs, err = m.Store.GetRuns(volumeID)
+	if err != nil {
+		err = fmt.Errorf("failed to get runs: %s", err)
+	}
+	return
+}
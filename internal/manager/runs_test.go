@@ -0,0 +1,54 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/internal/store"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// startRun / endRun
+func TestRuns(t *testing.T) {
+	m := &Manager{
+		Store: store.NewMemoryStore(),
+	}
+	givenVolume := &volume.Volume{
+		ID:   "foo",
+		Name: "foo",
+	}
+
+	run := m.startRun(givenVolume, "backup", volume.TriggerManual)
+	assert.Equal(t, m.getCurrentRun("foo"), run)
+	run.Status = "Success"
+	m.endRun(context.Background(), run, nil)
+	assert.Nil(t, m.getCurrentRun("foo"))
+
+	run = m.startRun(givenVolume, "backup", volume.TriggerScheduled)
+	m.endRun(context.Background(), run, errors.New("failed to deploy agent"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	run = m.startRun(givenVolume, "restore", volume.TriggerManual)
+	m.endRun(ctx, run, errors.New("failed to deploy agent"))
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	<-ctx.Done()
+	run = m.startRun(givenVolume, "backup", volume.TriggerScheduled)
+	m.endRun(ctx, run, nil)
+
+	runs, err := m.GetRuns("foo")
+	assert.Nil(t, err)
+	assert.Equal(t, len(runs), 4)
+	assert.Equal(t, runs[0].Status, "Success")
+	assert.Equal(t, runs[0].Trigger, volume.TriggerManual)
+	assert.Equal(t, runs[1].Status, "Failed")
+	assert.Equal(t, runs[1].Error, "failed to deploy agent")
+	assert.Equal(t, runs[2].Status, "Cancelled")
+	assert.Equal(t, runs[3].Status, "TimedOut")
+}
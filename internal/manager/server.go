@@ -3,7 +3,10 @@ package manager
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"strconv"
 
 	log "github.com/Sirupsen/logrus"
@@ -12,6 +15,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/pkg/volume"
 )
 
 // Server contains informations used by the server part
@@ -20,24 +24,49 @@ type Server struct {
 	PSK     string
 }
 
-// StartServer starts the API server
-func (m *Manager) StartServer() (err error) {
-	router := mux.NewRouter().StrictSlash(true)
-
+// StartServer starts the API server in background
+// An error is sent on errs if the server stops unexpectedly.
+func (m *Manager) StartServer() (srv *http.Server, errs chan error) {
 	setupMetrics(m.BuildInfo)
 
+	srv = &http.Server{
+		Addr:    m.Server.Address,
+		Handler: m.newRouter(),
+	}
+	errs = make(chan error, 1)
+
+	log.Infof("Listening on %s", m.Server.Address)
+	go func() {
+		err := srv.ListenAndServe()
+		if err != http.ErrServerClosed {
+			errs <- err
+		}
+	}()
+	return
+}
+
+// newRouter returns the routes of the API
+func (m *Manager) newRouter() (router *mux.Router) {
+	router = mux.NewRouter().StrictSlash(true)
+
 	router.Handle("/volumes", m.handleAPIRequest(http.HandlerFunc(m.getVolumes)))
+	router.Handle("/volumes/{volumeID}/runs", m.handleAPIRequest(http.HandlerFunc(m.getVolumeRuns)))
+	router.Handle("/volumes/{volumeID}/snapshots", m.handleAPIRequest(http.HandlerFunc(m.getVolumeSnapshots))).Methods("GET")
+	router.Handle("/volumes/{volumeID}/snapshots/{snapshotName}/ls", m.handleAPIRequest(http.HandlerFunc(m.listSnapshotFiles))).Methods("GET")
+	router.Handle("/volumes/{volumeID}/snapshots/{snapshotName}/dump", m.handleAPIRequest(http.HandlerFunc(m.dumpSnapshotFile))).Methods("GET")
 	router.Handle("/ping", m.handleAPIRequest(http.HandlerFunc(m.ping)))
 	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
-	router.Handle("/backup/{volumeName}", m.handleAPIRequest(http.HandlerFunc(m.backupVolume))).Queries("force", "{force}")
-	router.Handle("/backup/{volumeID}/logs", m.handleAPIRequest(http.HandlerFunc(m.getBackupLogs)))
-	router.Handle("/restore/{volumeName}", m.handleAPIRequest(http.HandlerFunc(m.restoreVolume))).Queries("force", "{force}")
-	router.Handle("/restore/{volumeName}/{snapshotName}", m.handleAPIRequest(http.HandlerFunc(m.restoreVolume))).Queries("force", "{force}")
-	router.Handle("/restic/{volumeID}", m.handleAPIRequest(http.HandlerFunc(m.runRawCommand)))
+	router.Handle("/backup/{volumeName}", m.handleAPIRequest(m.handleLeaderRequest(http.HandlerFunc(m.backupVolume)))).Queries("force", "{force}")
+	router.Handle("/backup/{volumeID}/logs", m.handleAPIRequest(m.handleLeaderForward(http.HandlerFunc(m.getBackupLogs))))
+	router.Handle("/check/{volumeID}/logs", m.handleAPIRequest(m.handleLeaderForward(m.getMaintenanceLogs(taskCheck))))
+	router.Handle("/prune/{volumeID}/logs", m.handleAPIRequest(m.handleLeaderForward(m.getMaintenanceLogs(taskPrune))))
+	router.Handle("/restore/{volumeName}", m.handleAPIRequest(m.handleLeaderRequest(http.HandlerFunc(m.restoreVolume)))).Queries("force", "{force}")
+	router.Handle("/restore/{volumeName}/{snapshotName}", m.handleAPIRequest(m.handleLeaderRequest(http.HandlerFunc(m.restoreVolume)))).Queries("force", "{force}")
+	router.Handle("/jobs/{jobID}", m.handleAPIRequest(m.handleLeaderForward(http.HandlerFunc(m.getJob)))).Methods("GET")
+	router.Handle("/jobs/{jobID}", m.handleAPIRequest(m.handleLeaderRequest(http.HandlerFunc(m.cancelJob)))).Methods("DELETE")
+	router.Handle("/restic/{volumeID}", m.handleAPIRequest(m.handleLeaderRequest(http.HandlerFunc(m.runRawCommand))))
+	router.Handle("/queue", m.handleAPIRequest(m.handleLeaderForward(http.HandlerFunc(m.getQueue))))
 	router.Handle("/info", m.handleAPIRequest(http.HandlerFunc(m.info)))
-
-	log.Infof("Listening on %s", m.Server.Address)
-	log.Fatal(http.ListenAndServe(m.Server.Address, router))
 	return
 }
 
@@ -52,6 +81,38 @@ func (m *Manager) handleAPIRequest(next http.Handler) http.Handler {
 	})
 }
 
+// handleLeaderRequest rejects requests which modify the state if the manager is not the leader
+func (m *Manager) handleLeaderRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.isLeader() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("503 - Not the leader"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleLeaderForward forwards the requests to the leader if the manager is not the leader,
+// e.g. the logs posted by the agents through a load balancer or the jobs which are only known by the leader
+func (m *Manager) handleLeaderForward(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.isLeader() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		address, err := m.getLeaderAddress()
+		if err != nil {
+			log.Errorf("failed to forward request to the leader: %s", err)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("503 - Not the leader"))
+			return
+		}
+		httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: address}).ServeHTTP(w, r)
+	})
+}
+
 func (m *Manager) getVolumes(w http.ResponseWriter, r *http.Request) {
 	b, err := json.Marshal(m.Volumes)
 	if err != nil {
@@ -65,22 +126,153 @@ func (m *Manager) getVolumes(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (m *Manager) backupVolume(w http.ResponseWriter, r *http.Request) {
+func (m *Manager) getVolumeRuns(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
-	force, err := strconv.ParseBool(params["force"])
+
+	runs, err := m.GetRuns(params["volumeID"])
 	if err != nil {
-		force = false
-		err = nil
+		log.Errorf("failed to get runs: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal server error"))
+		return
+	}
+	if runs == nil {
+		runs = []volume.Run{}
+	}
+
+	b, err := json.Marshal(runs)
+	if err != nil {
+		log.Errorf("failed to marshal runs: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+	return
+}
+
+func (m *Manager) getVolumeSnapshots(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	snapshots, err := m.GetSnapshots(params["volumeID"], r.URL.Query()["tag"])
+	if err == ErrVolumeNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 - Volume not found"))
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to get snapshots: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal server error"))
+		return
+	}
+
+	b, err := json.Marshal(snapshots)
+	if err != nil {
+		log.Errorf("failed to marshal snapshots: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+	return
+}
+
+func (m *Manager) listSnapshotFiles(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	nodes, err := m.ListSnapshotFiles(params["volumeID"], params["snapshotName"], r.URL.Query().Get("path"))
+	if err == ErrVolumeNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 - Volume not found"))
+		return
+	}
+	if err != nil {
+		log.Errorf("failed to list snapshot: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal server error"))
+		return
 	}
 
-	err = m.BackupVolume(params["volumeName"], force)
+	b, err := json.Marshal(nodes)
 	if err != nil {
+		log.Errorf("failed to marshal nodes: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		w.Write([]byte("500 - Internal server error"))
 		return
 	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"type": "success"}`))
+	w.Write(b)
+	return
+}
+
+// dumpSnapshotFile streams a file or a tar archive of a directory of a snapshot
+// Errors can only be reported with a status code until the dump starts,
+// the connection is then aborted so that the client does not get a truncated file as a complete one.
+func (m *Manager) dumpSnapshotFile(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	cw := &countingWriter{w: w}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	err := m.DumpSnapshotFile(r.Context(), params["volumeID"], params["snapshotName"], r.URL.Query().Get("path"), cw)
+	if err == nil {
+		return
+	}
+
+	log.Errorf("failed to dump snapshot: %s", err)
+	if cw.n > 0 {
+		panic(http.ErrAbortHandler)
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	if err == ErrVolumeNotFound {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 - Volume not found"))
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write([]byte("500 - Internal server error"))
+	return
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
+
+func (m *Manager) getQueue(w http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(m.GetQueue())
+	if err != nil {
+		log.Errorf("failed to marshal queue: %s", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("500 - Internal server error"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(b)
+	return
+}
+
+func (m *Manager) backupVolume(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	force, err := strconv.ParseBool(params["force"])
+	if err != nil {
+		force = false
+		err = nil
+	}
+
+	ignoreWindow, _ := strconv.ParseBool(r.URL.Query().Get("ignore_window"))
+
+	j, err := m.NewBackupJob(params["volumeName"], force, ignoreWindow)
+	m.writeJob(w, j, err)
 	return
 }
 
@@ -95,14 +287,55 @@ func (m *Manager) restoreVolume(w http.ResponseWriter, r *http.Request) {
 	if _, ok := params["snapshotName"]; ok {
 		snapshotName = params["snapshotName"]
 	}
-	err = m.RestoreVolume(params["volumeName"], force, snapshotName)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - Internal server error"))
+	query := r.URL.Query()
+	j, err := m.NewRestoreJob(params["volumeName"], force, snapshotName, query["include"], query["exclude"])
+	m.writeJob(w, j, err)
+	return
+}
+
+func (m *Manager) getJob(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	j, err := m.GetJob(params["jobID"])
+	m.writeJob(w, j, err)
+	return
+}
+
+func (m *Manager) cancelJob(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	j, err := m.CancelJob(params["jobID"])
+	m.writeJob(w, j, err)
+	return
+}
+
+func (m *Manager) writeJob(w http.ResponseWriter, j volume.Job, err error) {
+	switch err {
+	case nil:
+	case ErrVolumeNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 - Volume not found"))
+		return
+	case ErrJobNotFound:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 - Job not found"))
+		return
+	case ErrShuttingDown:
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("503 - Manager is shutting down"))
+		return
+	default:
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte("409 - " + err.Error()))
 		return
 	}
+
+	data := map[string]interface{}{
+		"type": "success",
+		"data": j,
+	}
+	encodedData, _ := json.Marshal(data)
+
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"type": "success"}`))
+	w.Write(encodedData)
 	return
 }
 
@@ -148,6 +381,35 @@ func (m *Manager) getBackupLogs(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
+// getMaintenanceLogs returns the log receiver of the agents running a maintenance task
+func (m *Manager) getMaintenanceLogs(task string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data struct {
+			Data utils.MsgFormat
+		}
+
+		params := mux.Vars(r)
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&data)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte("500 - Internal server error: " + err.Error()))
+			return
+		}
+
+		for _, v := range m.Volumes {
+			if v.ID == params["volumeID"] {
+				m.updateMaintenanceLogs(v, task, data.Data)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(`{"type": "success"}`))
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("404 - Volume not found"))
+	})
+}
+
 func (m *Manager) runRawCommand(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	var err error
@@ -193,4 +455,9 @@ func setupMetrics(buildInfo utils.BuildInfo) {
 	}, []string{"version", "commit_sha", "build_date", "golang_version"})
 	buildInfoMetric.WithLabelValues(buildInfo.Version, buildInfo.CommitSha1, buildInfo.Date, buildInfo.Runtime).Set(1)
 	prometheus.MustRegister(buildInfoMetric)
+	prometheus.MustRegister(queueDepthMetric)
+	prometheus.MustRegister(queueWaitMetric)
+	prometheus.MustRegister(leaderMetric)
+	prometheus.MustRegister(runningAgentsMetric)
+	prometheus.MustRegister(orphanAgentsRecoveredMetric)
 }
@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// serverShutdownTimeout is the maximum time to wait for the API requests in progress on shutdown
+const serverShutdownTimeout = 10 * time.Second
+
+// agentsStopTimeout is the maximum time to wait for the agents to be removed once the grace period is exceeded
+var agentsStopTimeout = 30 * time.Second
+
+// ErrShuttingDown is returned when a job is requested while the manager is shutting down
+var ErrShuttingDown = fmt.Errorf("manager is shutting down")
+
+// beginAgent registers an agent in flight
+// false is returned if the manager is shutting down, the agent must not be started.
+func (m *Manager) beginAgent() bool {
+	m.shutdownMux.Lock()
+	defer m.shutdownMux.Unlock()
+
+	if m.shuttingDown {
+		return false
+	}
+	m.agents.Add(1)
+	return true
+}
+
+// endAgent unregisters an agent started with beginAgent
+func (m *Manager) endAgent() {
+	m.agents.Done()
+}
+
+func (m *Manager) isShuttingDown() bool {
+	m.shutdownMux.Lock()
+	defer m.shutdownMux.Unlock()
+
+	return m.shuttingDown
+}
+
+// shutdown stops starting agents and waits for the agents in flight.
+// The remaining agents are stopped with stopAgents once the grace period is exceeded.
+// The API server is kept running meanwhile as agents send it their logs.
+func (m *Manager) shutdown(gracePeriod time.Duration, stopAgents context.CancelFunc, srv *http.Server) {
+	m.shutdownMux.Lock()
+	m.shuttingDown = true
+	m.shutdownMux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.agents.Wait()
+		close(done)
+	}()
+
+	log.WithFields(log.Fields{
+		"grace_period": gracePeriod,
+	}).Info("Waiting for the running agents...")
+	select {
+	case <-done:
+	case <-time.After(gracePeriod):
+		log.Warning("Grace period exceeded, stopping the running agents...")
+		stopAgents()
+		select {
+		case <-done:
+		case <-time.After(agentsStopTimeout):
+			log.Error("failed to stop the running agents in time, they may be left running")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		log.Errorf("failed to shut down API server: %s", err)
+	}
+
+	log.Info("Manager stopped.")
+	return
+}
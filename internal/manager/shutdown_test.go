@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// shutdown
+func TestShutdown(t *testing.T) {
+	m := &Manager{}
+	ctx, stopAgents := context.WithCancel(context.Background())
+
+	assert.True(t, m.beginAgent())
+	go func() {
+		defer m.endAgent()
+		<-ctx.Done()
+	}()
+
+	m.shutdown(10*time.Millisecond, stopAgents, &http.Server{})
+	assert.NotNil(t, ctx.Err())
+	assert.True(t, m.isShuttingDown())
+	assert.False(t, m.beginAgent())
+}
+
+func TestShutdownDrained(t *testing.T) {
+	m := &Manager{}
+	ctx, stopAgents := context.WithCancel(context.Background())
+	defer stopAgents()
+
+	assert.True(t, m.beginAgent())
+	go func() {
+		defer m.endAgent()
+		time.Sleep(10 * time.Millisecond)
+	}()
+
+	m.shutdown(time.Minute, stopAgents, &http.Server{})
+	assert.Nil(t, ctx.Err())
+}
+
+func TestShutdownStuckAgent(t *testing.T) {
+	m := &Manager{}
+	_, stopAgents := context.WithCancel(context.Background())
+	defer func(timeout time.Duration) { agentsStopTimeout = timeout }(agentsStopTimeout)
+	agentsStopTimeout = 10 * time.Millisecond
+
+	// The agent ignores the cancellation
+	assert.True(t, m.beginAgent())
+	defer m.endAgent()
+
+	done := make(chan bool)
+	go func() {
+		m.shutdown(10*time.Millisecond, stopAgents, &http.Server{})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("shutdown is blocked by the stuck agent")
+	}
+}
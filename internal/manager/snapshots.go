@@ -0,0 +1,104 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// getSnapshotTags returns the tags set on the snapshot of a backup
+func (m *Manager) getSnapshotTags(v *volume.Volume, provider, trigger string) (tags []string) {
+	if provider == "" {
+		provider = "none"
+	}
+
+	for _, t := range []struct {
+		key   string
+		value string
+	}{
+		{volume.TagVolumeID, v.ID},
+		{volume.TagVolumeName, v.Name},
+		{volume.TagNamespace, v.Namespace},
+		{volume.TagProvider, provider},
+		{volume.TagTrigger, trigger},
+		{volume.TagBivacVersion, m.BuildInfo.Version},
+	} {
+		if t.value != "" {
+			tags = append(tags, volume.FormatTag(t.key, t.value))
+		}
+	}
+	return
+}
+
+// GetSnapshots returns the snapshots of a volume having all the given tags, the oldest first
+func (m *Manager) GetSnapshots(volumeID string, tags []string) (snapshots []volume.Snapshot, err error) {
+	v := m.getVolume(volumeID)
+	if v == nil {
+		err = ErrVolumeNotFound
+		return
+	}
+
+	e, err := m.newEngine(v)
+	if err != nil {
+		return
+	}
+
+	all, err := e.Snapshots()
+	if err != nil {
+		err = fmt.Errorf("failed to get snapshots: %s", err)
+		return
+	}
+
+	snapshots = []volume.Snapshot{}
+	for _, s := range all {
+		snapshot := s.GetVolumeSnapshot()
+		if snapshot.HasTags(tags) {
+			snapshots = append(snapshots, snapshot)
+		}
+	}
+	return
+}
+
+// ListSnapshotFiles returns the content of the directory dir of a snapshot of a volume
+// dir is relative to the root of the volume, snapshotName is an ID, a short ID or `latest`.
+func (m *Manager) ListSnapshotFiles(volumeID, snapshotName, dir string) (nodes []volume.Node, err error) {
+	v := m.getVolume(volumeID)
+	if v == nil {
+		err = ErrVolumeNotFound
+		return
+	}
+
+	e, err := m.newEngine(v)
+	if err != nil {
+		return
+	}
+
+	all, err := e.Ls(snapshotName, dir)
+	if err != nil {
+		return
+	}
+
+	nodes = []volume.Node{}
+	for _, n := range all {
+		nodes = append(nodes, n.GetVolumeNode())
+	}
+	return
+}
+
+// DumpSnapshotFile writes the file p of a snapshot of a volume to w, or a tar archive of p if it is a directory
+func (m *Manager) DumpSnapshotFile(ctx context.Context, volumeID, snapshotName, p string, w io.Writer) (err error) {
+	v := m.getVolume(volumeID)
+	if v == nil {
+		err = ErrVolumeNotFound
+		return
+	}
+
+	e, err := m.newEngine(v)
+	if err != nil {
+		return
+	}
+
+	return e.Dump(ctx, snapshotName, p, w)
+}
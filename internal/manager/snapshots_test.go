@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gomock "github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/internal/engine"
+	"github.com/camptocamp/bivac/internal/utils"
+	"github.com/camptocamp/bivac/mocks"
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// getSnapshotTags
+func TestGetSnapshotTags(t *testing.T) {
+	m := &Manager{
+		BuildInfo: utils.BuildInfo{
+			Version: "2.4.0",
+		},
+	}
+	givenVolume := &volume.Volume{
+		ID:        "foo",
+		Name:      "foo,bar",
+		Namespace: "default",
+	}
+
+	tags := m.getSnapshotTags(givenVolume, "mysql", volume.TriggerManual)
+	assert.Equal(t, tags, []string{
+		"volume_id=foo",
+		"volume_name=foo_bar",
+		"namespace=default",
+		"provider=mysql",
+		"trigger=" + volume.TriggerManual,
+		"bivac_version=2.4.0",
+	})
+}
+
+func TestGetSnapshotTagsNoProvider(t *testing.T) {
+	m := &Manager{}
+	givenVolume := &volume.Volume{
+		ID:   "foo",
+		Name: "foo",
+	}
+
+	tags := m.getSnapshotTags(givenVolume, "", volume.TriggerScheduled)
+	assert.Equal(t, tags, []string{
+		"volume_id=foo",
+		"volume_name=foo",
+		"provider=none",
+		"trigger=" + volume.TriggerScheduled,
+	})
+}
+
+// GetSnapshots
+func TestGetSnapshotsVolumeNotFound(t *testing.T) {
+	m := &Manager{}
+
+	_, err := m.GetSnapshots("foo", nil)
+	assert.Equal(t, err, ErrVolumeNotFound)
+}
+
+// dumpSnapshotFile
+func TestDumpSnapshotFileVolumeNotFound(t *testing.T) {
+	m := &Manager{}
+
+	rec := httptest.NewRecorder()
+	m.dumpSnapshotFile(rec, httptest.NewRequest("GET", "/volumes/foo/snapshots/latest/dump?path=/bar", nil))
+	assert.Equal(t, rec.Code, http.StatusNotFound)
+	assert.Equal(t, rec.Header().Get("Content-Type"), "text/plain")
+}
+
+// cancelingResponseWriter cancels the request once the response has started
+type cancelingResponseWriter struct {
+	*httptest.ResponseRecorder
+	cancel context.CancelFunc
+}
+
+func (w *cancelingResponseWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.ResponseRecorder.Write(p)
+}
+
+func TestDumpSnapshotFileInterrupted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockOrchestrator := mocks.NewMockOrchestrator(mockCtrl)
+
+	dir, err := ioutil.TempDir("", "bivac-volume")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	assert.Nil(t, os.MkdirAll(filepath.Join(dir, "data"), 0755))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "data", "foo"), []byte("foo"), 0644))
+	repo, err := ioutil.TempDir("", "bivac-repo")
+	assert.Nil(t, err)
+	defer os.RemoveAll(repo)
+
+	e, err := engine.NewEngine("tar", repo+"/foo/foo")
+	assert.Nil(t, err)
+	e.Backup(dir, "foo", false, engine.BackupOptions{})
+
+	m := &Manager{
+		Orchestrator: mockOrchestrator,
+		TargetURL:    repo,
+		Engine:       "tar",
+		Volumes: []*volume.Volume{
+			&volume.Volume{
+				ID:       "foo",
+				Name:     "foo",
+				RepoName: "foo",
+			},
+		},
+	}
+	mockOrchestrator.EXPECT().GetPath(gomock.Any()).Return("foo").AnyTimes()
+	mockOrchestrator.EXPECT().GetCredentials(gomock.Any()).Return(nil, nil).AnyTimes()
+
+	// The connection is aborted as the dump is incomplete
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := httptest.NewRequest("GET", "/volumes/foo/snapshots/latest/dump?path=/data", nil).WithContext(ctx)
+	r = mux.SetURLVars(r, map[string]string{"volumeID": "foo", "snapshotName": "latest"})
+	w := &cancelingResponseWriter{ResponseRecorder: httptest.NewRecorder(), cancel: cancel}
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		m.dumpSnapshotFile(w, r)
+	})
+}
@@ -2,9 +2,16 @@ package manager
 
 import (
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 	"unicode/utf8"
 
+	log "github.com/Sirupsen/logrus"
+	"github.com/robfig/cron/v3"
+
 	"github.com/camptocamp/bivac/internal/engine"
+	"github.com/camptocamp/bivac/internal/store"
 	"github.com/camptocamp/bivac/pkg/volume"
 )
 
@@ -28,13 +35,20 @@ func retrieveVolumes(m *Manager, volumeFilters volume.Filters) (err error) {
 		volumeManaged = false
 		for _, mv := range m.Volumes {
 			if mv.ID == nv.ID {
+				// Options may have been updated since the volume was discovered
+				mv.Labels = nv.Labels
+				mv.Annotations = nv.Annotations
+				mv.NamespaceAnnotations = nv.NamespaceAnnotations
+				m.setVolumeOptions(mv)
 				volumeManaged = true
 				break
 			}
 		}
 		if !volumeManaged {
+			m.setVolumeOptions(nv)
 			nv.SetupMetrics()
 			getLastBackupDate(m, nv)
+			loadVolumeState(m, nv)
 			m.Volumes = append(m.Volumes, nv)
 		}
 	}
@@ -86,17 +100,145 @@ func blacklistedVolume(vol *volume.Volume, volumeFilters volume.Filters) (bool,
 	return false, "", ""
 }
 
+// setVolumeOptions reads the Bivac options set as labels or annotations on the volume
+func (m *Manager) setVolumeOptions(v *volume.Volume) {
+	v.Schedule = ""
+	if schedule, ok := v.GetOption("bivac.schedule"); ok {
+		if _, err := cron.ParseStandard(schedule); err != nil {
+			log.WithFields(log.Fields{
+				"volume":   v.Name,
+				"hostname": v.Hostname,
+			}).Errorf("invalid schedule `%s', using backup interval instead: %s", schedule, err)
+		} else {
+			v.Schedule = schedule
+		}
+	}
+
+	v.Priority = 0
+	if priority, ok := v.GetOption("bivac.priority"); ok {
+		if p, err := strconv.Atoi(priority); err != nil {
+			log.WithFields(log.Fields{
+				"volume":   v.Name,
+				"hostname": v.Hostname,
+			}).Errorf("invalid priority `%s', using default priority instead", priority)
+		} else {
+			v.Priority = p
+		}
+	}
+
+	v.BackupWindow = ""
+	if window, ok := v.GetOption("bivac.window"); ok {
+		if _, err := parseBackupWindows(window); err != nil {
+			log.WithFields(log.Fields{
+				"volume":   v.Name,
+				"hostname": v.Hostname,
+			}).Errorf("invalid backup window, using global backup window instead: %s", err)
+		} else {
+			v.BackupWindow = window
+		}
+	}
+
+	v.Blackout = ""
+	if blackout, ok := v.GetOption("bivac.blackout"); ok {
+		if _, err := parseBackupWindows(blackout); err != nil {
+			log.WithFields(log.Fields{
+				"volume":   v.Name,
+				"hostname": v.Hostname,
+			}).Errorf("invalid blackout period, ignoring it: %s", err)
+		} else {
+			v.Blackout = blackout
+		}
+	}
+
+	v.BackupTimeout = ""
+	if timeout, ok := v.GetOption("bivac.timeout"); ok {
+		if d, err := time.ParseDuration(timeout); err != nil || d <= 0 {
+			log.WithFields(log.Fields{
+				"volume":   v.Name,
+				"hostname": v.Hostname,
+			}).Errorf("invalid timeout `%s', using backup timeout instead", timeout)
+		} else {
+			v.BackupTimeout = timeout
+		}
+	}
+
+	v.Retention = m.getRetentionPolicy(v)
+
+	v.Excludes = nil
+	if exclude, ok := v.GetOption("bivac.exclude"); ok {
+		v.Excludes = splitPatterns(exclude)
+	}
+
+	v.Includes = nil
+	if include, ok := v.GetOption("bivac.include"); ok {
+		v.Includes = splitPatterns(include)
+	}
+}
+
+// splitPatterns returns the patterns of a comma separated list
+func splitPatterns(list string) (patterns []string) {
+	for _, p := range strings.Split(list, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return
+}
+
+// retentionOptions are the options defining the retention policy of a volume
+var retentionOptions = []string{
+	"bivac.keep-last",
+	"bivac.keep-daily",
+	"bivac.keep-weekly",
+	"bivac.keep-monthly",
+	"bivac.keep-yearly",
+}
+
+// getRetentionPolicy returns the effective retention policy of a volume
+// The retention options set on the volume or its namespace override the ones of the global policy set in RESTIC_FORGET_ARGS.
+func (m *Manager) getRetentionPolicy(v *volume.Volume) *volume.RetentionPolicy {
+	policy := m.Retention
+	policy.Source = volume.RetentionSourceGlobal
+	for _, key := range retentionOptions {
+		value, ok := v.GetRetentionOption(key)
+		if !ok {
+			continue
+		}
+
+		count, err := strconv.Atoi(value)
+		if err != nil || count < 0 {
+			log.WithFields(log.Fields{
+				"volume":   v.Name,
+				"hostname": v.Hostname,
+			}).Errorf("invalid value `%s' for %s, ignoring it", value, key)
+			continue
+		}
+
+		switch key {
+		case "bivac.keep-last":
+			policy.Last = count
+		case "bivac.keep-daily":
+			policy.Daily = count
+		case "bivac.keep-weekly":
+			policy.Weekly = count
+		case "bivac.keep-monthly":
+			policy.Monthly = count
+		case "bivac.keep-yearly":
+			policy.Yearly = count
+		}
+		policy.Source = volume.RetentionSourceVolume
+	}
+	return &policy
+}
+
 func getLastBackupDate(m *Manager, v *volume.Volume) (err error) {
-	e := &engine.Engine{
-		DefaultArgs: []string{
-			"--no-cache",
-			"--json",
-			"-r",
-			m.TargetURL + "/" + m.Orchestrator.GetPath(v) + "/" + v.RepoName,
-		},
+	e, err := m.newEngine(v)
+	if err != nil {
+		return
 	}
 
-	latestBackup, oldestBackup, err := e.GetBackupDates()
+	latestBackup, oldestBackup, err := engine.GetBackupDates(e)
 	if err != nil {
 		return
 	}
@@ -113,3 +255,96 @@ func getLastBackupDate(m *Manager, v *volume.Volume) (err error) {
 	v.Metrics.LastBackupStatus.Set(-1)
 	return
 }
+
+// loadVolumeState restores the volume's state saved before the last manager restart
+func loadVolumeState(m *Manager, v *volume.Volume) {
+	if m.Store == nil {
+		return
+	}
+
+	state, found, err := m.Store.GetVolumeState(v.ID)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"volume":   v.Name,
+			"hostname": v.Hostname,
+		}).Errorf("failed to load volume state: %s", err)
+		return
+	}
+	if !found {
+		return
+	}
+	applyVolumeState(v, state)
+	return
+}
+
+// reloadVolumeStates restores the states of the volumes, which may have been updated by another manager
+func reloadVolumeStates(m *Manager) {
+	if m.Store == nil {
+		return
+	}
+
+	states, err := m.Store.GetVolumeStates()
+	if err != nil {
+		log.Errorf("failed to reload volume states: %s", err)
+		return
+	}
+	for _, v := range m.Volumes {
+		if state, ok := states[v.ID]; ok {
+			applyVolumeState(v, state)
+		}
+	}
+}
+
+func applyVolumeState(v *volume.Volume, state store.VolumeState) {
+	v.LastBackupDate = state.LastBackupDate
+	v.LastBackupStatus = state.LastBackupStatus
+	v.LastFailureKind = state.LastFailureKind
+	v.ConsecutiveFailures = state.ConsecutiveFailures
+	v.LastBackupStats = state.LastBackupStats
+	if v.LastBackupStats != nil {
+		v.Metrics.LastBackupBytesAdded.Set(float64(v.LastBackupStats.DataAdded))
+	}
+	v.LastCheckDate = state.LastCheckDate
+	v.LastCheckStatus = state.LastCheckStatus
+	v.LastPruneDate = state.LastPruneDate
+	v.LastPruneStatus = state.LastPruneStatus
+	setCheckStatusMetric(v)
+	if state.Logs != nil {
+		v.Logs = state.Logs
+	}
+
+	switch v.LastBackupStatus {
+	case "Success":
+		v.Metrics.LastBackupStatus.Set(0.0)
+	case "Failed", "Cancelled", "TimedOut":
+		v.Metrics.LastBackupStatus.Set(1.0)
+	}
+	return
+}
+
+// saveVolumeState persists the volume's state
+func saveVolumeState(m *Manager, v *volume.Volume) {
+	if m.Store == nil {
+		return
+	}
+
+	err := m.Store.SaveVolumeState(v.ID, store.VolumeState{
+		LastBackupDate:      v.LastBackupDate,
+		LastBackupStatus:    v.LastBackupStatus,
+		LastFailureKind:     v.LastFailureKind,
+		ConsecutiveFailures: v.ConsecutiveFailures,
+		LastBackupStats:     v.LastBackupStats,
+		LastCheckDate:       v.LastCheckDate,
+		LastCheckStatus:     v.LastCheckStatus,
+		LastPruneDate:       v.LastPruneDate,
+		LastPruneStatus:     v.LastPruneStatus,
+		Logs:                v.Logs,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{
+			"volume":   v.Name,
+			"hostname": v.Hostname,
+		}).Errorf("failed to save volume state: %s", err)
+	}
+	return
+}
@@ -2,11 +2,14 @@ package manager
 
 import (
 	"fmt"
+	"os"
 	"testing"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/camptocamp/bivac/internal/store"
 	"github.com/camptocamp/bivac/mocks"
 	"github.com/camptocamp/bivac/pkg/volume"
 )
@@ -36,11 +39,15 @@ func TestRetrieveVolumesBasic(t *testing.T) {
 			ID:       "foo",
 			Name:     "foo",
 			HostBind: "localhost",
+
+			Retention: &volume.RetentionPolicy{Source: volume.RetentionSourceGlobal},
 		},
 		&volume.Volume{
 			ID:       "bar",
 			Name:     "bar",
 			HostBind: "localhost",
+
+			Retention: &volume.RetentionPolicy{Source: volume.RetentionSourceGlobal},
 		},
 	}
 
@@ -50,6 +57,7 @@ func TestRetrieveVolumesBasic(t *testing.T) {
 
 	// Run test
 	mockOrchestrator.EXPECT().GetPath(gomock.Any()).Return("localhost").Times(2)
+	mockOrchestrator.EXPECT().GetCredentials(gomock.Any()).Return(nil, nil).Times(2)
 	mockOrchestrator.EXPECT().GetVolumes(volume.Filters{}).Return(givenVolumes, nil).Times(1)
 
 	m.Volumes = []*volume.Volume{}
@@ -88,6 +96,8 @@ func TestRetrieveVolumesBlacklist(t *testing.T) {
 		&volume.Volume{
 			ID:   "bar",
 			Name: "bar",
+
+			Retention: &volume.RetentionPolicy{Source: volume.RetentionSourceGlobal},
 		},
 	}
 
@@ -97,6 +107,7 @@ func TestRetrieveVolumesBlacklist(t *testing.T) {
 
 	// Run test
 	mockOrchestrator.EXPECT().GetPath(gomock.Any()).Return("localhost").Times(1)
+	mockOrchestrator.EXPECT().GetCredentials(gomock.Any()).Return(nil, nil).Times(1)
 	mockOrchestrator.EXPECT().GetVolumes(volume.Filters{}).Return(givenVolumes, nil).Times(1)
 
 	m.Volumes = []*volume.Volume{}
@@ -136,6 +147,8 @@ func TestRetrieveVolumesWhitelist(t *testing.T) {
 		&volume.Volume{
 			ID:   "foo",
 			Name: "foo",
+
+			Retention: &volume.RetentionPolicy{Source: volume.RetentionSourceGlobal},
 		},
 	}
 
@@ -203,6 +216,8 @@ func TestRetrieveVolumesAppend(t *testing.T) {
 			ID:       "foo",
 			Name:     "foo",
 			HostBind: "localhost",
+
+			Retention: &volume.RetentionPolicy{Source: volume.RetentionSourceGlobal},
 		},
 		//&volume.Volume{
 		//	ID:   "bar",
@@ -252,6 +267,8 @@ func TestRetrieveVolumesRemove(t *testing.T) {
 			Name:     "bar",
 			HostBind: "bar",
 			Hostname: "bar",
+
+			Retention: &volume.RetentionPolicy{Source: volume.RetentionSourceGlobal},
 		},
 	}
 
@@ -381,3 +398,164 @@ func TestBlacklistedVolumeBlacklistedBecauseWhitelist(t *testing.T) {
 	assert.Equal(t, result1, "blacklisted")
 	assert.Equal(t, result2, "whitelist config")
 }
+
+// loadVolumeState
+func TestLoadVolumeState(t *testing.T) {
+	givenVolume := &volume.Volume{
+		ID:               "state",
+		Name:             "state",
+		LastBackupDate:   "2020-01-01 10:30:00",
+		LastBackupStatus: "Success",
+		Logs:             make(map[string]string),
+	}
+	givenVolume.SetupMetrics()
+	defer givenVolume.CleanupMetrics()
+
+	m := &Manager{
+		Store: store.NewMemoryStore(),
+	}
+
+	givenVolume.LastBackupStatus = "Failed"
+	givenVolume.Logs["backup"] = "[1] failed"
+	saveVolumeState(m, givenVolume)
+
+	restoredVolume := &volume.Volume{
+		ID:               "state",
+		Name:             "state",
+		LastBackupDate:   "2020-01-01 10:30:00",
+		LastBackupStatus: "Unknown",
+		Metrics:          givenVolume.Metrics,
+	}
+	loadVolumeState(m, restoredVolume)
+
+	assert.Equal(t, restoredVolume.LastBackupStatus, "Failed")
+	assert.Equal(t, restoredVolume.Logs["backup"], "[1] failed")
+}
+
+// setVolumeOptions
+func TestSetVolumeOptions(t *testing.T) {
+	m := &Manager{}
+	givenVolume := &volume.Volume{
+		Labels: map[string]string{
+			"bivac.schedule": "0 3 * * *",
+			"bivac.timeout":  "3h",
+		},
+	}
+
+	m.setVolumeOptions(givenVolume)
+	assert.Equal(t, givenVolume.Schedule, "0 3 * * *")
+	assert.Equal(t, givenVolume.BackupTimeout, "3h")
+
+	givenVolume.Labels["bivac.timeout"] = "foo"
+	m.setVolumeOptions(givenVolume)
+	assert.Equal(t, givenVolume.BackupTimeout, "")
+}
+
+// getRetentionPolicy
+func TestGetRetentionPolicy(t *testing.T) {
+	m := &Manager{
+		Retention: volume.RetentionPolicy{Last: 3, Daily: 15},
+	}
+
+	givenVolume := &volume.Volume{}
+	assert.Equal(t, m.getRetentionPolicy(givenVolume), &volume.RetentionPolicy{
+		Source: volume.RetentionSourceGlobal,
+		Last:   3,
+		Daily:  15,
+	})
+
+	givenVolume = &volume.Volume{
+		Labels: map[string]string{
+			"bivac.keep-daily": "7",
+			"bivac.keep-last":  "foo",
+		},
+		NamespaceAnnotations: map[string]string{
+			"bivac.keep-weekly": "4",
+		},
+	}
+	assert.Equal(t, m.getRetentionPolicy(givenVolume), &volume.RetentionPolicy{
+		Source: volume.RetentionSourceVolume,
+		Last:   3,
+		Daily:  7,
+		Weekly: 4,
+	})
+
+	// The global options can be disabled
+	givenVolume = &volume.Volume{
+		Labels: map[string]string{
+			"bivac.keep-last": "0",
+		},
+	}
+	assert.Equal(t, m.getRetentionPolicy(givenVolume), &volume.RetentionPolicy{
+		Source: volume.RetentionSourceVolume,
+		Daily:  15,
+	})
+}
+
+// getAgentEnv
+func TestGetAgentEnv(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockOrchestrator := mocks.NewMockOrchestrator(mockCtrl)
+
+	os.Setenv("RESTIC_PASSWORD", "global")
+	defer os.Unsetenv("RESTIC_PASSWORD")
+	os.Setenv("AWS_ACCESS_KEY_ID", "global")
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "global")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	givenVolume := &volume.Volume{
+		ID:   "foo",
+		Name: "foo",
+		Retention: &volume.RetentionPolicy{
+			Source: volume.RetentionSourceVolume,
+			Daily:  7,
+		},
+	}
+	m := &Manager{
+		Orchestrator: mockOrchestrator,
+		ForgetArgs:   "--group-by host --keep-daily 15",
+	}
+
+	mockOrchestrator.EXPECT().GetCredentials(givenVolume).Return(map[string]string{"RESTIC_PASSWORD": "foo=="}, nil).Times(1)
+	env, err := m.getAgentEnv(givenVolume)
+	assert.Nil(t, err)
+	assert.Contains(t, env, "RESTIC_FORGET_ARGS=--group-by host --keep-daily 7")
+	assert.Contains(t, env, "RESTIC_PASSWORD=foo==")
+	assert.NotContains(t, env, "RESTIC_PASSWORD=global")
+	// The backend keys are still the global ones
+	assert.Contains(t, env, "AWS_ACCESS_KEY_ID=global")
+	assert.Contains(t, env, "AWS_SECRET_ACCESS_KEY=global")
+
+	// The credentials are cached
+	// and the repository is pruned by the prune maintenance
+	m.ForgetArgs = "--group-by host --keep-daily 15 --prune"
+	m.PruneInterval = time.Hour
+	env, err = m.getAgentEnv(givenVolume)
+	assert.Nil(t, err)
+	assert.Contains(t, env, "RESTIC_FORGET_ARGS=--group-by host --keep-daily 7")
+	assert.Contains(t, env, "RESTIC_PASSWORD=foo==")
+
+	// The keys of a backend replace all the global ones of the backend
+	m.credentials = nil
+	mockOrchestrator.EXPECT().GetCredentials(givenVolume).Return(map[string]string{"AWS_ACCESS_KEY_ID": "foo"}, nil).Times(1)
+	env, err = m.getAgentEnv(givenVolume)
+	assert.Nil(t, err)
+	assert.Contains(t, env, "AWS_ACCESS_KEY_ID=foo")
+	assert.NotContains(t, env, "AWS_SECRET_ACCESS_KEY=global")
+	assert.Contains(t, env, "RESTIC_PASSWORD=global")
+
+	// The global credentials are used by the volumes without credentials
+	m.credentials = nil
+	mockOrchestrator.EXPECT().GetCredentials(givenVolume).Return(nil, nil).Times(1)
+	env, err = m.getAgentEnv(givenVolume)
+	assert.Nil(t, err)
+	assert.Contains(t, env, "RESTIC_PASSWORD=global")
+	assert.Contains(t, env, "AWS_ACCESS_KEY_ID=global")
+
+	m.credentials = nil
+	mockOrchestrator.EXPECT().GetCredentials(givenVolume).Return(nil, fmt.Errorf("secret not found")).Times(1)
+	_, err = m.getAgentEnv(givenVolume)
+	assert.NotNil(t, err)
+}
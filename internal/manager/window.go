@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// backupWindow is a daily period of time, e.g. `22:00-06:00 Europe/Zurich`
+type backupWindow struct {
+	start    int
+	end      int
+	location *time.Location
+}
+
+// parseBackupWindows parses a comma separated list of periods.
+// The time zone of a period is UTC if not specified.
+func parseBackupWindows(value string) (windows []backupWindow, err error) {
+	for _, w := range strings.Split(value, ",") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+
+		var window backupWindow
+		window, err = parseBackupWindow(w)
+		if err != nil {
+			return
+		}
+		windows = append(windows, window)
+	}
+	return
+}
+
+func parseBackupWindow(value string) (window backupWindow, err error) {
+	fields := strings.Fields(value)
+	if len(fields) < 1 || len(fields) > 2 {
+		err = fmt.Errorf("invalid period `%s', expected `HH:MM-HH:MM [TIMEZONE]'", value)
+		return
+	}
+
+	window.location = time.UTC
+	if len(fields) == 2 {
+		window.location, err = time.LoadLocation(fields[1])
+		if err != nil {
+			err = fmt.Errorf("invalid time zone `%s': %s", fields[1], err)
+			return
+		}
+	}
+
+	bounds := strings.Split(fields[0], "-")
+	if len(bounds) != 2 {
+		err = fmt.Errorf("invalid period `%s', expected `HH:MM-HH:MM [TIMEZONE]'", value)
+		return
+	}
+
+	window.start, err = parseMinutes(bounds[0])
+	if err != nil {
+		return
+	}
+	window.end, err = parseMinutes(bounds[1])
+	return
+}
+
+// parseMinutes returns the count of minutes since midnight
+func parseMinutes(value string) (minutes int, err error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		err = fmt.Errorf("invalid time `%s': %s", value, err)
+		return
+	}
+	minutes = t.Hour()*60 + t.Minute()
+	return
+}
+
+// contains returns true if the date is inside the period.
+// A period whose start and end are equal lasts the whole day.
+func (w backupWindow) contains(date time.Time) bool {
+	date = date.In(w.location)
+	minutes := date.Hour()*60 + date.Minute()
+
+	if w.start == w.end {
+		return true
+	}
+	if w.start < w.end {
+		return minutes >= w.start && minutes < w.end
+	}
+	// The period spans midnight
+	return minutes >= w.start || minutes < w.end
+}
+
+// inWindows returns true if the date is inside one of the periods
+func inWindows(windows []backupWindow, date time.Time) bool {
+	for _, w := range windows {
+		if w.contains(date) {
+			return true
+		}
+	}
+	return false
+}
+
+// isInBackupWindow returns true if the volume can be backed up at the given date.
+// The volume's window replaces the global one while blackouts of both apply.
+func (m *Manager) isInBackupWindow(v *volume.Volume, date time.Time) bool {
+	windows := m.BackupWindows
+	if v.BackupWindow != "" {
+		windows, _ = parseBackupWindows(v.BackupWindow)
+	}
+	if len(windows) > 0 && !inWindows(windows, date) {
+		return false
+	}
+
+	blackouts, _ := parseBackupWindows(v.Blackout)
+	return !inWindows(m.Blackouts, date) && !inWindows(blackouts, date)
+}
@@ -0,0 +1,70 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// parseBackupWindows
+func TestParseBackupWindows(t *testing.T) {
+	windows, err := parseBackupWindows("22:00-06:00 Europe/Zurich, 12:00-13:00")
+	assert.Nil(t, err)
+	assert.Equal(t, len(windows), 2)
+	assert.Equal(t, windows[0].start, 22*60)
+	assert.Equal(t, windows[0].end, 6*60)
+	assert.Equal(t, windows[0].location.String(), "Europe/Zurich")
+	assert.Equal(t, windows[1].location, time.UTC)
+
+	_, err = parseBackupWindows("22:00")
+	assert.NotNil(t, err)
+	_, err = parseBackupWindows("22:00-25:00")
+	assert.NotNil(t, err)
+	_, err = parseBackupWindows("22:00-06:00 Foo/Bar")
+	assert.NotNil(t, err)
+}
+
+// contains
+func TestBackupWindowContains(t *testing.T) {
+	windows, _ := parseBackupWindows("22:00-06:00")
+	window := windows[0]
+
+	assert.True(t, window.contains(time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, window.contains(time.Date(2020, 1, 1, 5, 59, 0, 0, time.UTC)))
+	assert.False(t, window.contains(time.Date(2020, 1, 1, 6, 0, 0, 0, time.UTC)))
+	assert.False(t, window.contains(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)))
+
+	windows, _ = parseBackupWindows("08:00-18:00 Europe/Zurich")
+	window = windows[0]
+
+	// 07:30 UTC is 08:30 in Zurich during winter
+	assert.True(t, window.contains(time.Date(2020, 1, 1, 7, 30, 0, 0, time.UTC)))
+	assert.False(t, window.contains(time.Date(2020, 1, 1, 17, 30, 0, 0, time.UTC)))
+}
+
+// isInBackupWindow
+func TestIsInBackupWindow(t *testing.T) {
+	windows, _ := parseBackupWindows("22:00-06:00")
+	blackouts, _ := parseBackupWindows("02:00-03:00")
+	m := &Manager{
+		BackupWindows: windows,
+		Blackouts:     blackouts,
+	}
+	night := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+	day := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	blackout := time.Date(2020, 1, 1, 2, 30, 0, 0, time.UTC)
+
+	assert.True(t, m.isInBackupWindow(&volume.Volume{}, night))
+	assert.False(t, m.isInBackupWindow(&volume.Volume{}, day))
+	assert.False(t, m.isInBackupWindow(&volume.Volume{}, blackout))
+
+	// The volume's window replaces the global one
+	assert.True(t, m.isInBackupWindow(&volume.Volume{BackupWindow: "10:00-14:00"}, day))
+	assert.False(t, m.isInBackupWindow(&volume.Volume{BackupWindow: "10:00-14:00"}, night))
+
+	// Blackouts are cumulative
+	assert.False(t, m.isInBackupWindow(&volume.Volume{Blackout: "23:00-23:30"}, night))
+}
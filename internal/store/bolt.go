@@ -0,0 +1,176 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+var (
+	volumesBucket = []byte("volumes")
+	runsBucket    = []byte("runs")
+)
+
+// BoltStore implements a store persisted in a BoltDB file
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// NewBoltStore opens (or creates) a BoltDB database
+func NewBoltStore(path string) (s *BoltStore, err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to create database directory: %s", err)
+		return
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		err = fmt.Errorf("failed to open database `%s': %s", path, err)
+		return
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{volumesBucket, runsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		err = fmt.Errorf("failed to initialize database: %s", err)
+		return
+	}
+
+	s = &BoltStore{
+		db: db,
+	}
+	return
+}
+
+// GetVolumeState returns the state of a volume
+func (s *BoltStore) GetVolumeState(volumeID string) (state VolumeState, found bool, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(volumesBucket).Get([]byte(volumeID))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, &state)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to read state of volume `%s': %s", volumeID, err)
+	}
+	return
+}
+
+// GetVolumeStates returns the states of all the volumes
+func (s *BoltStore) GetVolumeStates() (states map[string]VolumeState, err error) {
+	states = make(map[string]VolumeState)
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(volumesBucket).ForEach(func(k, data []byte) error {
+			var state VolumeState
+			if err := json.Unmarshal(data, &state); err != nil {
+				return err
+			}
+			states[string(k)] = state
+			return nil
+		})
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to read volume states: %s", err)
+	}
+	return
+}
+
+// SaveVolumeState saves the state of a volume
+func (s *BoltStore) SaveVolumeState(volumeID string, state VolumeState) (err error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal state of volume `%s': %s", volumeID, err)
+		return
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(volumesBucket).Put([]byte(volumeID), data)
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to save state of volume `%s': %s", volumeID, err)
+	}
+	return
+}
+
+// SaveRun adds or updates a run in the history of its volume
+func (s *BoltStore) SaveRun(run volume.Run) (err error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal run `%s': %s", run.ID, err)
+		return
+	}
+
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(runsBucket).CreateBucketIfNotExists([]byte(run.VolumeID))
+		if err != nil {
+			return err
+		}
+
+		err = b.Put([]byte(run.ID), data)
+		if err != nil {
+			return err
+		}
+
+		// Run IDs are prefixed with their start date, the oldest runs come first
+		var keys [][]byte
+		b.ForEach(func(k, _ []byte) error {
+			keys = append(keys, append([]byte{}, k...))
+			return nil
+		})
+		for i := 0; i < len(keys)-MaxRunsPerVolume; i++ {
+			if err := b.Delete(keys[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to save run `%s': %s", run.ID, err)
+	}
+	return
+}
+
+// GetRuns returns the history of a volume, from the oldest to the most recent run
+func (s *BoltStore) GetRuns(volumeID string) (runs []volume.Run, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(runsBucket).Bucket([]byte(volumeID))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, data []byte) error {
+			var run volume.Run
+			if err := json.Unmarshal(data, &run); err != nil {
+				return err
+			}
+			runs = append(runs, run)
+			return nil
+		})
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to read runs of volume `%s': %s", volumeID, err)
+		return
+	}
+	sortRuns(runs)
+	return
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"sync"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// MemoryStore implements a store which doesn't persist anything on disk
+type MemoryStore struct {
+	volumes map[string]VolumeState
+	runs    map[string][]volume.Run
+
+	mux sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		volumes: make(map[string]VolumeState),
+		runs:    make(map[string][]volume.Run),
+	}
+}
+
+// GetVolumeState returns the state of a volume
+func (s *MemoryStore) GetVolumeState(volumeID string) (state VolumeState, found bool, err error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	state, found = s.volumes[volumeID]
+	return
+}
+
+// GetVolumeStates returns the states of all the volumes
+func (s *MemoryStore) GetVolumeStates() (states map[string]VolumeState, err error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	states = make(map[string]VolumeState)
+	for volumeID, state := range s.volumes {
+		states[volumeID] = state
+	}
+	return
+}
+
+// SaveVolumeState saves the state of a volume
+func (s *MemoryStore) SaveVolumeState(volumeID string, state VolumeState) (err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	s.volumes[volumeID] = state
+	return
+}
+
+// SaveRun adds or updates a run in the history of its volume
+func (s *MemoryStore) SaveRun(run volume.Run) (err error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	runs := s.runs[run.VolumeID]
+	for i := range runs {
+		if runs[i].ID == run.ID {
+			runs[i] = run
+			return
+		}
+	}
+
+	runs = append(runs, run)
+	sortRuns(runs)
+	if len(runs) > MaxRunsPerVolume {
+		runs = runs[len(runs)-MaxRunsPerVolume:]
+	}
+	s.runs[run.VolumeID] = runs
+	return
+}
+
+// GetRuns returns the history of a volume, from the oldest to the most recent run
+func (s *MemoryStore) GetRuns(volumeID string) (runs []volume.Run, err error) {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+
+	runs = append(runs, s.runs[volumeID]...)
+	return
+}
+
+// Close does nothing
+func (s *MemoryStore) Close() (err error) {
+	return
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SharedStateBackend stores entries shared by several managers, e.g. in the orchestrator
+type SharedStateBackend interface {
+	GetSharedState() (state map[string]string, err error)
+	SaveSharedState(key, value string) (err error)
+}
+
+// SharedStore implements a store whose volume states are shared by several managers,
+// so that a newly elected leader resumes the schedule of the previous one.
+// The runs and the logs are large, they are only kept in the local store.
+type SharedStore struct {
+	Store
+	backend SharedStateBackend
+}
+
+// NewSharedStore creates a store sharing the volume states through backend
+func NewSharedStore(local Store, backend SharedStateBackend) *SharedStore {
+	return &SharedStore{
+		Store:   local,
+		backend: backend,
+	}
+}
+
+// GetVolumeState returns the shared state of a volume, with its local logs
+func (s *SharedStore) GetVolumeState(volumeID string) (state VolumeState, found bool, err error) {
+	states, err := s.GetVolumeStates()
+	if err != nil {
+		return
+	}
+	state, found = states[volumeID]
+	return
+}
+
+// GetVolumeStates returns the shared states of all the volumes, with their local logs
+func (s *SharedStore) GetVolumeStates() (states map[string]VolumeState, err error) {
+	shared, err := s.backend.GetSharedState()
+	if err != nil {
+		err = fmt.Errorf("failed to read shared volume states: %s", err)
+		return
+	}
+	local, err := s.Store.GetVolumeStates()
+	if err != nil {
+		return
+	}
+
+	states = make(map[string]VolumeState)
+	for volumeID, data := range shared {
+		var state VolumeState
+		err = json.Unmarshal([]byte(data), &state)
+		if err != nil {
+			err = fmt.Errorf("failed to parse shared state of volume `%s': %s", volumeID, err)
+			return
+		}
+		state.Logs = local[volumeID].Logs
+		states[volumeID] = state
+	}
+	return
+}
+
+// SaveVolumeState saves the state of a volume in the local store and its state without the logs in the shared one
+func (s *SharedStore) SaveVolumeState(volumeID string, state VolumeState) (err error) {
+	err = s.Store.SaveVolumeState(volumeID, state)
+	if err != nil {
+		return
+	}
+
+	state.Logs = nil
+	data, err := json.Marshal(state)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal state of volume `%s': %s", volumeID, err)
+		return
+	}
+	err = s.backend.SaveSharedState(volumeID, string(data))
+	if err != nil {
+		err = fmt.Errorf("failed to save shared state of volume `%s': %s", volumeID, err)
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"sort"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+// MaxRunsPerVolume is the number of runs kept in the history of a volume
+const MaxRunsPerVolume = 100
+
+// Store persists the state of the Bivac manager
+type Store interface {
+	GetVolumeState(volumeID string) (state VolumeState, found bool, err error)
+	GetVolumeStates() (states map[string]VolumeState, err error)
+	SaveVolumeState(volumeID string, state VolumeState) error
+	SaveRun(run volume.Run) error
+	GetRuns(volumeID string) (runs []volume.Run, err error)
+	Close() error
+}
+
+// VolumeState stores the informations of a volume which must survive a manager restart
+type VolumeState struct {
+	LastBackupDate      string
+	LastBackupStatus    string
+	LastFailureKind     string
+	ConsecutiveFailures int
+	LastBackupStats     *volume.BackupStats
+	LastCheckDate       string
+	LastCheckStatus     string
+	LastPruneDate       string
+	LastPruneStatus     string
+	Logs                map[string]string
+}
+
+// NewStore returns a store persisted in a database file located at path.
+// If path is empty, the state is only kept in memory.
+func NewStore(path string) (s Store, err error) {
+	if path == "" {
+		s = NewMemoryStore()
+		return
+	}
+	return NewBoltStore(path)
+}
+
+// sortRuns sorts runs from the oldest to the most recent one
+func sortRuns(runs []volume.Run) {
+	sort.SliceStable(runs, func(i, j int) bool {
+		return runs[i].StartDate.Before(runs[j].StartDate)
+	})
+}
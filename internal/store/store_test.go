@@ -0,0 +1,150 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/camptocamp/bivac/pkg/volume"
+)
+
+func TestMemoryStoreVolumeState(t *testing.T) {
+	s, err := NewStore("")
+	assert.Nil(t, err)
+	defer s.Close()
+
+	testVolumeState(t, s)
+}
+
+func TestBoltStoreVolumeState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(filepath.Join(dir, "bivac.db"))
+	assert.Nil(t, err)
+
+	testVolumeState(t, s)
+
+	// State must survive a restart
+	s.Close()
+	s, err = NewStore(filepath.Join(dir, "bivac.db"))
+	assert.Nil(t, err)
+	defer s.Close()
+
+	state, found, err := s.GetVolumeState("foo")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, state.LastBackupStatus, "Failed")
+}
+
+func testVolumeState(t *testing.T, s Store) {
+	_, found, err := s.GetVolumeState("foo")
+	assert.Nil(t, err)
+	assert.False(t, found)
+
+	givenState := VolumeState{
+		LastBackupDate:   "2020-01-01 10:30:00",
+		LastBackupStatus: "Failed",
+		Logs: map[string]string{
+			"backup": "[1] failed",
+		},
+	}
+	err = s.SaveVolumeState("foo", givenState)
+	assert.Nil(t, err)
+
+	state, found, err := s.GetVolumeState("foo")
+	assert.Nil(t, err)
+	assert.True(t, found)
+	assert.Equal(t, state, givenState)
+}
+
+func TestMemoryStoreRuns(t *testing.T) {
+	s, err := NewStore("")
+	assert.Nil(t, err)
+	defer s.Close()
+
+	testRuns(t, s)
+}
+
+func TestBoltStoreRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := NewStore(filepath.Join(dir, "bivac.db"))
+	assert.Nil(t, err)
+	defer s.Close()
+
+	testRuns(t, s)
+}
+
+func testRuns(t *testing.T, s Store) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < MaxRunsPerVolume+5; i++ {
+		date := start.Add(time.Duration(i) * time.Hour)
+		err := s.SaveRun(volume.Run{
+			ID:        fmt.Sprintf("%s-%03d", date.Format("20060102150405"), i),
+			VolumeID:  "foo",
+			Status:    "Running",
+			StartDate: date,
+		})
+		assert.Nil(t, err)
+	}
+
+	runs, err := s.GetRuns("foo")
+	assert.Nil(t, err)
+	assert.Equal(t, len(runs), MaxRunsPerVolume)
+	assert.Equal(t, runs[0].StartDate, start.Add(5*time.Hour))
+
+	// Update the last run
+	lastRun := runs[len(runs)-1]
+	lastRun.Status = "Success"
+	err = s.SaveRun(lastRun)
+	assert.Nil(t, err)
+
+	runs, err = s.GetRuns("foo")
+	assert.Nil(t, err)
+	assert.Equal(t, len(runs), MaxRunsPerVolume)
+	assert.Equal(t, runs[len(runs)-1].Status, "Success")
+
+	runs, err = s.GetRuns("bar")
+	assert.Nil(t, err)
+	assert.Equal(t, len(runs), 0)
+}
+
+// mapBackend implements a shared state backend in memory
+type mapBackend map[string]string
+
+func (b mapBackend) GetSharedState() (state map[string]string, err error) {
+	return b, nil
+}
+
+func (b mapBackend) SaveSharedState(key, value string) (err error) {
+	b[key] = value
+	return
+}
+
+func TestSharedStoreVolumeState(t *testing.T) {
+	backend := mapBackend{}
+	s := NewSharedStore(NewMemoryStore(), backend)
+	defer s.Close()
+
+	testVolumeState(t, s)
+
+	// The logs are not shared
+	other := NewSharedStore(NewMemoryStore(), backend)
+	states, err := other.GetVolumeStates()
+	assert.Nil(t, err)
+	assert.Equal(t, states, map[string]VolumeState{
+		"foo": {
+			LastBackupDate:   "2020-01-01 10:30:00",
+			LastBackupStatus: "Failed",
+		},
+	})
+}
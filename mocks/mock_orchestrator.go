@@ -5,6 +5,7 @@
 package mocks
 
 import (
+	context "context"
 	volume "github.com/camptocamp/bivac/pkg/volume"
 	gomock "github.com/golang/mock/gomock"
 	reflect "reflect"
@@ -77,9 +78,9 @@ func (mr *MockOrchestratorMockRecorder) GetVolumes(volumeFilters interface{}) *g
 }
 
 // DeployAgent mocks base method
-func (m *MockOrchestrator) DeployAgent(image string, cmd, envs []string, volume *volume.Volume) (bool, string, error) {
+func (m *MockOrchestrator) DeployAgent(ctx context.Context, image string, cmd, envs []string, volume *volume.Volume) (bool, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "DeployAgent", image, cmd, envs, volume)
+	ret := m.ctrl.Call(m, "DeployAgent", ctx, image, cmd, envs, volume)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
@@ -87,9 +88,9 @@ func (m *MockOrchestrator) DeployAgent(image string, cmd, envs []string, volume
 }
 
 // DeployAgent indicates an expected call of DeployAgent
-func (mr *MockOrchestratorMockRecorder) DeployAgent(image, cmd, envs, volume interface{}) *gomock.Call {
+func (mr *MockOrchestratorMockRecorder) DeployAgent(ctx, image, cmd, envs, volume interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeployAgent", reflect.TypeOf((*MockOrchestrator)(nil).DeployAgent), image, cmd, envs, volume)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeployAgent", reflect.TypeOf((*MockOrchestrator)(nil).DeployAgent), ctx, image, cmd, envs, volume)
 }
 
 // GetContainersMountingVolume mocks base method
@@ -153,9 +154,9 @@ func (mr *MockOrchestratorMockRecorder) RetrieveOrphanAgents() *gomock.Call {
 }
 
 // AttachOrphanAgent mocks base method
-func (m *MockOrchestrator) AttachOrphanAgent(containerID, namespace string) (bool, string, error) {
+func (m *MockOrchestrator) AttachOrphanAgent(ctx context.Context, containerID, namespace string) (bool, string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AttachOrphanAgent", containerID, namespace)
+	ret := m.ctrl.Call(m, "AttachOrphanAgent", ctx, containerID, namespace)
 	ret0, _ := ret[0].(bool)
 	ret1, _ := ret[1].(string)
 	ret2, _ := ret[2].(error)
@@ -163,7 +164,80 @@ func (m *MockOrchestrator) AttachOrphanAgent(containerID, namespace string) (boo
 }
 
 // AttachOrphanAgent indicates an expected call of AttachOrphanAgent
-func (mr *MockOrchestratorMockRecorder) AttachOrphanAgent(containerID, namespace interface{}) *gomock.Call {
+func (mr *MockOrchestratorMockRecorder) AttachOrphanAgent(ctx, containerID, namespace interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttachOrphanAgent", reflect.TypeOf((*MockOrchestrator)(nil).AttachOrphanAgent), containerID, namespace)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AttachOrphanAgent", reflect.TypeOf((*MockOrchestrator)(nil).AttachOrphanAgent), ctx, containerID, namespace)
+}
+
+// RunLeaderElection mocks base method
+func (m *MockOrchestrator) RunLeaderElection(ctx context.Context, identity string, onElected func(context.Context)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RunLeaderElection", ctx, identity, onElected)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RunLeaderElection indicates an expected call of RunLeaderElection
+func (mr *MockOrchestratorMockRecorder) RunLeaderElection(ctx, identity, onElected interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RunLeaderElection", reflect.TypeOf((*MockOrchestrator)(nil).RunLeaderElection), ctx, identity, onElected)
+}
+
+// GetLeader mocks base method
+func (m *MockOrchestrator) GetLeader() (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLeader")
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLeader indicates an expected call of GetLeader
+func (mr *MockOrchestratorMockRecorder) GetLeader() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLeader", reflect.TypeOf((*MockOrchestrator)(nil).GetLeader))
+}
+
+// GetSharedState mocks base method
+func (m *MockOrchestrator) GetSharedState() (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSharedState")
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSharedState indicates an expected call of GetSharedState
+func (mr *MockOrchestratorMockRecorder) GetSharedState() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSharedState", reflect.TypeOf((*MockOrchestrator)(nil).GetSharedState))
+}
+
+// SaveSharedState mocks base method
+func (m *MockOrchestrator) SaveSharedState(key, value string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSharedState", key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSharedState indicates an expected call of SaveSharedState
+func (mr *MockOrchestratorMockRecorder) SaveSharedState(key, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSharedState", reflect.TypeOf((*MockOrchestrator)(nil).SaveSharedState), key, value)
+}
+
+// GetCredentials mocks base method
+func (m *MockOrchestrator) GetCredentials(v *volume.Volume) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCredentials", v)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCredentials indicates an expected call of GetCredentials
+func (mr *MockOrchestratorMockRecorder) GetCredentials(v interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCredentials", reflect.TypeOf((*MockOrchestrator)(nil).GetCredentials), v)
 }
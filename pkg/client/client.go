@@ -5,10 +5,13 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/camptocamp/bivac/pkg/volume"
 )
@@ -49,9 +52,9 @@ func (c *Client) GetVolumes() (volumes []volume.Volume, err error) {
 	return
 }
 
-// BackupVolume requests a backup of a volume
-func (c *Client) BackupVolume(volumeName string, force bool) (err error) {
-	err = c.newRequest(nil, "POST", fmt.Sprintf("/backup/%s?force=%s", volumeName, strconv.FormatBool(force)), "")
+// GetRuns returns the backup and restore history of a volume
+func (c *Client) GetRuns(volumeID string) (runs []volume.Run, err error) {
+	err = c.newRequest(&runs, "GET", fmt.Sprintf("/volumes/%s/runs", volumeID), "")
 	if err != nil {
 		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
 		return
@@ -59,20 +62,109 @@ func (c *Client) BackupVolume(volumeName string, force bool) (err error) {
 	return
 }
 
-// RestoreVolume requests a restore of a volume
+// GetSnapshots returns the snapshots of a volume having all the given tags
+func (c *Client) GetSnapshots(volumeID string, tags []string) (snapshots []volume.Snapshot, err error) {
+	query := url.Values{}
+	for _, tag := range tags {
+		query.Add("tag", tag)
+	}
+	path := fmt.Sprintf("/volumes/%s/snapshots", url.PathEscape(volumeID))
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	err = c.newRequest(&snapshots, "GET", path, "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	return
+}
+
+// ListSnapshotFiles returns the content of the directory dir of a snapshot of a volume
+func (c *Client) ListSnapshotFiles(volumeID, snapshotName, dir string) (nodes []volume.Node, err error) {
+	path := fmt.Sprintf("/volumes/%s/snapshots/%s/ls", url.PathEscape(volumeID), url.PathEscape(snapshotName))
+	if dir != "" {
+		path += "?" + url.Values{"path": []string{dir}}.Encode()
+	}
+
+	err = c.newRequest(&nodes, "GET", path, "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	return
+}
+
+// DumpSnapshotFile writes the file p of a snapshot of a volume to w, or a tar archive of p if it is a directory
+func (c *Client) DumpSnapshotFile(volumeID, snapshotName, p string, w io.Writer) (err error) {
+	path := fmt.Sprintf("/volumes/%s/snapshots/%s/dump", url.PathEscape(volumeID), url.PathEscape(snapshotName))
+	path += "?" + url.Values{"path": []string{p}}.Encode()
+
+	err = c.newStreamRequest(w, "GET", path, "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	return
+}
+
+// GetQueue returns the volumes waiting for a backup
+func (c *Client) GetQueue() (entries []volume.QueueEntry, err error) {
+	err = c.newRequest(&entries, "GET", "/queue", "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	return
+}
+
+// BackupVolume requests a backup of a volume and returns the created job
+// The backup window of the volume is ignored if ignoreWindow is set.
+func (c *Client) BackupVolume(volumeName string, force, ignoreWindow bool) (job volume.Job, err error) {
+	var data struct {
+		Type string `json:"type"`
+		Data volume.Job
+	}
+	err = c.newRequest(&data, "POST", fmt.Sprintf("/backup/%s?force=%s&ignore_window=%s", volumeName, strconv.FormatBool(force), strconv.FormatBool(ignoreWindow)), "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	job = data.Data
+	return
+}
+
+// RestoreVolume requests a restore of a volume and returns the created job
+// Only the paths matching includes, if any, and not matching excludes are restored.
+// Paths are relative to the root of the volume.
 func (c *Client) RestoreVolume(
 	volumeName string,
 	force bool,
 	snapshotName string,
-) (err error) {
+	includes,
+	excludes []string,
+) (job volume.Job, err error) {
+	var data struct {
+		Type string `json:"type"`
+		Data volume.Job
+	}
+	query := url.Values{}
+	query.Set("force", strconv.FormatBool(force))
+	for _, include := range includes {
+		query.Add("include", include)
+	}
+	for _, exclude := range excludes {
+		query.Add("exclude", exclude)
+	}
 	err = c.newRequest(
-		nil,
+		&data,
 		"POST",
 		fmt.Sprintf(
-			"/restore/%s/%s?force=%s",
+			"/restore/%s/%s?%s",
 			volumeName,
 			snapshotName,
-			strconv.FormatBool(force),
+			query.Encode(),
 		),
 		"",
 	)
@@ -83,9 +175,51 @@ func (c *Client) RestoreVolume(
 		)
 		return
 	}
+	job = data.Data
+	return
+}
+
+// GetJob returns a backup or restore job
+func (c *Client) GetJob(jobID string) (job volume.Job, err error) {
+	var data struct {
+		Type string `json:"type"`
+		Data volume.Job
+	}
+	err = c.newRequest(&data, "GET", fmt.Sprintf("/jobs/%s", jobID), "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	job = data.Data
 	return
 }
 
+// CancelJob cancels a backup or restore job
+func (c *Client) CancelJob(jobID string) (job volume.Job, err error) {
+	var data struct {
+		Type string `json:"type"`
+		Data volume.Job
+	}
+	err = c.newRequest(&data, "DELETE", fmt.Sprintf("/jobs/%s", jobID), "")
+	if err != nil {
+		err = fmt.Errorf("failed to connect to the remote Bivac instance: %s", err)
+		return
+	}
+	job = data.Data
+	return
+}
+
+// WaitJob polls a job until it is over
+func (c *Client) WaitJob(jobID string, interval time.Duration) (job volume.Job, err error) {
+	for {
+		job, err = c.GetJob(jobID)
+		if err != nil || job.IsDone() {
+			return
+		}
+		time.Sleep(interval)
+	}
+}
+
 // RunRawCommand runs a custom Restic command on a volume's repository and returns the output
 func (c *Client) RunRawCommand(volumeID string, cmd []string) (output string, err error) {
 	var response map[string]interface{}
@@ -124,18 +258,8 @@ func (c *Client) GetInformations() (informations map[string]string, err error) {
 }
 
 func (c *Client) newRequest(data interface{}, method, endpoint, value string) (err error) {
-	client := &http.Client{}
-	req, err := http.NewRequest(method, c.remoteAddress+endpoint, bytes.NewBuffer([]byte(value)))
-	if err != nil {
-		err = fmt.Errorf("failed to build request: %s", err)
-		return
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.psk))
-
-	res, err := client.Do(req)
+	res, err := c.sendRequest(method, endpoint, value)
 	if err != nil {
-		err = fmt.Errorf("failed to send request: %s", err)
 		return
 	}
 	defer res.Body.Close()
@@ -157,3 +281,42 @@ func (c *Client) newRequest(data interface{}, method, endpoint, value string) (e
 	}
 	return
 }
+
+// newStreamRequest copies the body of the response to w
+func (c *Client) newStreamRequest(w io.Writer, method, endpoint, value string) (err error) {
+	res, err := c.sendRequest(method, endpoint, value)
+	if err != nil {
+		return
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		err = fmt.Errorf("received wrong status code from the Bivac instance: [%d] %s", res.StatusCode, string(body))
+		return
+	}
+
+	_, err = io.Copy(w, res.Body)
+	if err != nil {
+		err = fmt.Errorf("failed to read body: %s", err)
+	}
+	return
+}
+
+func (c *Client) sendRequest(method, endpoint, value string) (res *http.Response, err error) {
+	client := &http.Client{}
+	req, err := http.NewRequest(method, c.remoteAddress+endpoint, bytes.NewBuffer([]byte(value)))
+	if err != nil {
+		err = fmt.Errorf("failed to build request: %s", err)
+		return
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.psk))
+
+	res, err = client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("failed to send request: %s", err)
+		return
+	}
+	return
+}
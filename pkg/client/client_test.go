@@ -1,8 +1,10 @@
 package client
 
 import (
+	"bytes"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gopkg.in/jarcoal/httpmock.v1"
@@ -158,3 +160,246 @@ func TestGetVolumesValid(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, volumes, expectedVolumes)
 }
+
+// GetRuns
+func TestGetRunsValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	fakeResponse := `[
+		{
+			"id": "20200101103000-abcdef",
+			"volumeid": "foo",
+			"type": "backup",
+			"trigger": "scheduled",
+			"status": "Success",
+			"exitcodes": {"backup": 0}
+		}
+	]`
+
+	expectedRuns := []volume.Run{
+		volume.Run{
+			ID:        "20200101103000-abcdef",
+			VolumeID:  "foo",
+			Type:      "backup",
+			Trigger:   "scheduled",
+			Status:    "Success",
+			ExitCodes: map[string]int{"backup": 0},
+		},
+	}
+
+	// Run test
+	httpmock.RegisterResponder("GET", "http://fakeserver/volumes/foo/runs",
+		httpmock.NewStringResponder(200, fakeResponse))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	runs, err := c.GetRuns("foo")
+
+	assert.Nil(t, err)
+	assert.Equal(t, runs, expectedRuns)
+}
+
+// GetSnapshots
+func TestGetSnapshotsValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	fakeResponse := `[
+		{
+			"id": "abcdef123456",
+			"short_id": "abcdef12",
+			"paths": ["/data"],
+			"hostname": "foo",
+			"tags": ["volume_id=foo", "trigger=manual"]
+		}
+	]`
+
+	expectedSnapshots := []volume.Snapshot{
+		volume.Snapshot{
+			ID:       "abcdef123456",
+			ShortID:  "abcdef12",
+			Hostname: "foo",
+			Paths:    []string{"/data"},
+			Tags:     []string{"volume_id=foo", "trigger=manual"},
+		},
+	}
+
+	// Run test
+	httpmock.RegisterResponder("GET", "http://fakeserver/volumes/foo/snapshots?tag=trigger=manual",
+		httpmock.NewStringResponder(200, fakeResponse))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	snapshots, err := c.GetSnapshots("foo", []string{"trigger=manual"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, snapshots, expectedSnapshots)
+}
+
+// ListSnapshotFiles
+func TestListSnapshotFilesValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	fakeResponse := `[
+		{
+			"name": "foo",
+			"type": "file",
+			"path": "/data/foo",
+			"size": 3,
+			"mtime": "2020-01-01T10:00:00Z"
+		}
+	]`
+
+	expectedNodes := []volume.Node{
+		volume.Node{
+			Name:    "foo",
+			Type:    "file",
+			Path:    "/data/foo",
+			Size:    3,
+			ModTime: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}
+
+	// Run test
+	httpmock.RegisterResponder("GET", "http://fakeserver/volumes/foo/snapshots/latest/ls?path=/data",
+		httpmock.NewStringResponder(200, fakeResponse))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	nodes, err := c.ListSnapshotFiles("foo", "latest", "/data")
+
+	assert.Nil(t, err)
+	assert.Equal(t, nodes, expectedNodes)
+}
+
+// DumpSnapshotFile
+func TestDumpSnapshotFileValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// Run test
+	httpmock.RegisterResponder("GET", "http://fakeserver/volumes/foo/snapshots/latest/dump?path=/data/foo",
+		httpmock.NewStringResponder(200, "foo"))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	var b bytes.Buffer
+	err := c.DumpSnapshotFile("foo", "latest", "/data/foo", &b)
+
+	assert.Nil(t, err)
+	assert.Equal(t, b.String(), "foo")
+}
+
+func TestDumpSnapshotFileWrongStatusCode(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// Run test
+	httpmock.RegisterResponder("GET", "http://fakeserver/volumes/foo/snapshots/latest/dump?path=/data/foo",
+		httpmock.NewStringResponder(404, "404 - Volume not found"))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	var b bytes.Buffer
+	err := c.DumpSnapshotFile("foo", "latest", "/data/foo", &b)
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "wrong status code")
+	assert.Equal(t, b.Len(), 0)
+}
+
+// BackupVolume
+func TestBackupVolumeValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	fakeResponse := `{"type": "success", "data": {"id": "abc", "type": "backup", "volumeid": "foo", "status": "Pending"}}`
+
+	expectedJob := volume.Job{
+		ID:       "abc",
+		Type:     "backup",
+		VolumeID: "foo",
+		Status:   volume.JobPending,
+	}
+
+	// Run test
+	httpmock.RegisterResponder("POST", "http://fakeserver/backup/foo?force=false&ignore_window=false",
+		httpmock.NewStringResponder(200, fakeResponse))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	job, err := c.BackupVolume("foo", false, false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, job, expectedJob)
+}
+
+// RestoreVolume
+func TestRestoreVolumeValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	fakeResponse := `{"type": "success", "data": {"id": "abc", "type": "restore", "volumeid": "foo", "status": "Pending"}}`
+
+	expectedJob := volume.Job{
+		ID:       "abc",
+		Type:     "restore",
+		VolumeID: "foo",
+		Status:   volume.JobPending,
+	}
+
+	// Run test
+	httpmock.RegisterResponder("POST", "http://fakeserver/restore/foo/latest?exclude=/data/cache&force=false&include=/data&include=/etc",
+		httpmock.NewStringResponder(200, fakeResponse))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	job, err := c.RestoreVolume("foo", false, "latest", []string{"/data", "/etc"}, []string{"/data/cache"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, job, expectedJob)
+}
+
+// WaitJob
+func TestWaitJobValid(t *testing.T) {
+	// Prepare test
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	// Run test
+	httpmock.RegisterResponder("GET", "http://fakeserver/jobs/abc",
+		httpmock.NewStringResponder(200, `{"type": "success", "data": {"id": "abc", "status": "Failed", "error": "failed to deploy agent"}}`))
+
+	c := &Client{
+		remoteAddress: "http://fakeserver",
+		psk:           "psk",
+	}
+	job, err := c.WaitJob("abc", time.Millisecond)
+
+	assert.Nil(t, err)
+	assert.Equal(t, job.Status, volume.JobFailed)
+	assert.Equal(t, job.Error, "failed to deploy agent")
+}
@@ -2,6 +2,7 @@ package orchestrators
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -63,6 +64,35 @@ func (*CattleOrchestrator) GetPath(v *volume.Volume) string {
 	return v.Hostname
 }
 
+// RunLeaderElection is not supported on Cattle
+func (*CattleOrchestrator) RunLeaderElection(ctx context.Context, identity string, onElected func(ctx context.Context)) (err error) {
+	err = fmt.Errorf("leader election is not supported by the Cattle orchestrator")
+	return
+}
+
+// GetLeader is not supported on Cattle
+func (*CattleOrchestrator) GetLeader() (identity string, err error) {
+	err = fmt.Errorf("leader election is not supported by the Cattle orchestrator")
+	return
+}
+
+// GetSharedState is not supported on Cattle
+func (*CattleOrchestrator) GetSharedState() (state map[string]string, err error) {
+	err = fmt.Errorf("shared state is not supported by the Cattle orchestrator")
+	return
+}
+
+// SaveSharedState is not supported on Cattle
+func (*CattleOrchestrator) SaveSharedState(key, value string) (err error) {
+	err = fmt.Errorf("shared state is not supported by the Cattle orchestrator")
+	return
+}
+
+// GetCredentials returns no credentials, the repositories use the credentials of the manager
+func (*CattleOrchestrator) GetCredentials(v *volume.Volume) (credentials map[string]string, err error) {
+	return
+}
+
 // GetVolumes returns the Cattle volumes, inspected and filtered
 func (o *CattleOrchestrator) GetVolumes(volumeFilters volume.Filters) (volumes []*volume.Volume, err error) {
 	vs, err := o.client.Volume.List(&client.ListOpts{
@@ -138,7 +168,7 @@ func createAgentName() string {
 }
 
 // DeployAgent creates a `bivac agent` container
-func (o *CattleOrchestrator) DeployAgent(image string, cmd []string, envs []string, v *volume.Volume) (success bool, output string, err error) {
+func (o *CattleOrchestrator) DeployAgent(ctx context.Context, image string, cmd []string, envs []string, v *volume.Volume) (success bool, output string, err error) {
 	success = false
 
 	environment := make(map[string]interface{})
@@ -210,7 +240,13 @@ func (o *CattleOrchestrator) DeployAgent(image string, cmd []string, envs []stri
 			terminated = true
 			success = false
 		}
-		time.Sleep(1 * time.Second)
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("agent interrupted: %s", ctx.Err())
+			return false, "", err
+		case <-time.After(1 * time.Second):
+		}
 	}
 
 	container, err = o.client.Container.ById(container.Id)
@@ -403,7 +439,7 @@ func (o *CattleOrchestrator) RetrieveOrphanAgents() (containers map[string]strin
 }
 
 // AttachOrphanAgent connects to a running agent and wait for the end of the backup proccess
-func (o *CattleOrchestrator) AttachOrphanAgent(containerID, namespace string) (success bool, output string, err error) {
+func (o *CattleOrchestrator) AttachOrphanAgent(ctx context.Context, containerID, namespace string) (success bool, output string, err error) {
 	container, err := o.client.Container.ById(containerID)
 	if err != nil {
 		err = fmt.Errorf("failed to retrieve the container from ID: %s", err)
@@ -447,7 +483,13 @@ func (o *CattleOrchestrator) AttachOrphanAgent(containerID, namespace string) (s
 			terminated = true
 			success = false
 		}
-		time.Sleep(1 * time.Second)
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("agent interrupted: %s", ctx.Err())
+			return false, "", err
+		case <-time.After(1 * time.Second):
+		}
 	}
 
 	container, err = o.client.Container.ById(container.Id)
@@ -0,0 +1,73 @@
+package orchestrators
+
+import (
+	"strings"
+)
+
+// credentialVariables are the environment variables which can be set by repository credentials, with their backend
+// Other variables are ignored so that credentials cannot alter the agent or the manager,
+// e.g. with LD_PRELOAD or RESTIC_PASSWORD_COMMAND.
+var credentialVariables = map[string]string{
+	"RESTIC_PASSWORD": "restic",
+
+	"AWS_ACCESS_KEY_ID":     "aws",
+	"AWS_SECRET_ACCESS_KEY": "aws",
+	"AWS_SESSION_TOKEN":     "aws",
+	"AWS_DEFAULT_REGION":    "aws",
+
+	"AZURE_ACCOUNT_NAME": "azure",
+	"AZURE_ACCOUNT_KEY":  "azure",
+	"AZURE_ACCOUNT_SAS":  "azure",
+
+	"B2_ACCOUNT_ID":  "b2",
+	"B2_ACCOUNT_KEY": "b2",
+
+	"GOOGLE_PROJECT_ID":   "google",
+	"GOOGLE_ACCESS_TOKEN": "google",
+
+	"OS_AUTH_URL":                      "swift",
+	"OS_REGION_NAME":                   "swift",
+	"OS_USERNAME":                      "swift",
+	"OS_USER_ID":                       "swift",
+	"OS_PASSWORD":                      "swift",
+	"OS_TENANT_ID":                     "swift",
+	"OS_TENANT_NAME":                   "swift",
+	"OS_USER_DOMAIN_NAME":              "swift",
+	"OS_USER_DOMAIN_ID":                "swift",
+	"OS_PROJECT_NAME":                  "swift",
+	"OS_PROJECT_DOMAIN_NAME":           "swift",
+	"OS_PROJECT_DOMAIN_ID":             "swift",
+	"OS_TRUST_ID":                      "swift",
+	"OS_APPLICATION_CREDENTIAL_ID":     "swift",
+	"OS_APPLICATION_CREDENTIAL_NAME":   "swift",
+	"OS_APPLICATION_CREDENTIAL_SECRET": "swift",
+	"OS_STORAGE_URL":                   "swift",
+	"OS_AUTH_TOKEN":                    "swift",
+	"ST_AUTH":                          "swift",
+	"ST_USER":                          "swift",
+	"ST_KEY":                           "swift",
+}
+
+// GetCredentialBackend returns the backend of an environment variable set by repository credentials
+// An empty string is returned if the variable cannot be set by credentials.
+func GetCredentialBackend(name string) string {
+	// Such variables make restic run commands or read files
+	if strings.HasSuffix(name, "_COMMAND") || strings.HasSuffix(name, "_FILE") {
+		return ""
+	}
+	return credentialVariables[name]
+}
+
+// filterCredentials returns the credentials which are environment variables of the backup engine
+func filterCredentials(raw map[string]string) (credentials map[string]string) {
+	for key, value := range raw {
+		if GetCredentialBackend(key) == "" {
+			continue
+		}
+		if credentials == nil {
+			credentials = make(map[string]string)
+		}
+		credentials[key] = value
+	}
+	return
+}
@@ -0,0 +1,33 @@
+package orchestrators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// filterCredentials
+func TestFilterCredentials(t *testing.T) {
+	credentials := filterCredentials(map[string]string{
+		"RESTIC_PASSWORD":         "s3cr3t==",
+		"RESTIC_PASSWORD_COMMAND": "sh -c 'id'",
+		"RESTIC_PASSWORD_FILE":    "/etc/shadow",
+		"RESTIC_REPOSITORY":       "s3:foo",
+		"AWS_ACCESS_KEY_ID":       "foo",
+		"LD_PRELOAD":              "/tmp/foo.so",
+	})
+	assert.Equal(t, credentials, map[string]string{
+		"RESTIC_PASSWORD":   "s3cr3t==",
+		"AWS_ACCESS_KEY_ID": "foo",
+	})
+
+	assert.Nil(t, filterCredentials(map[string]string{"RESTIC_PASSWORD_COMMAND": "id"}))
+}
+
+// GetCredentialBackend
+func TestGetCredentialBackend(t *testing.T) {
+	assert.Equal(t, GetCredentialBackend("AWS_SECRET_ACCESS_KEY"), "aws")
+	assert.Equal(t, GetCredentialBackend("RESTIC_PASSWORD"), "restic")
+	assert.Equal(t, GetCredentialBackend("RESTIC_FORGET_ARGS"), "")
+	assert.Equal(t, GetCredentialBackend("GOOGLE_APPLICATION_CREDENTIALS"), "")
+}
@@ -7,8 +7,10 @@ import (
 	"os"
 	"sort"
 	"strings"
+	"time"
 	"unicode/utf8"
 
+	"github.com/BurntSushi/toml"
 	"github.com/docker/docker/api/types"
 	containertypes "github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
@@ -22,8 +24,15 @@ import (
 
 // DockerConfig stores Docker configuration
 type DockerConfig struct {
-	Endpoint string
-	Network  string
+	Endpoint        string
+	Network         string
+	LockFile        string
+	CredentialsFile string
+}
+
+// dockerCredentials maps the volume names to the credentials of their repository
+type dockerCredentials struct {
+	Volumes map[string]map[string]string `toml:"volumes"`
 }
 
 // DockerOrchestrator implements a container orchestrator for Docker
@@ -54,6 +63,62 @@ func (*DockerOrchestrator) GetPath(v *volume.Volume) string {
 	return v.Hostname
 }
 
+// RunLeaderElection campaigns for the leadership in background using a lock file shared by the managers
+func (o *DockerOrchestrator) RunLeaderElection(ctx context.Context, identity string, onElected func(ctx context.Context)) (err error) {
+	if o.config.LockFile == "" {
+		err = fmt.Errorf("no lock file configured")
+		return
+	}
+	elector := &fileLeaderElector{
+		path:     o.config.LockFile,
+		identity: identity,
+	}
+	go elector.run(ctx, onElected)
+	return
+}
+
+// GetLeader returns the identity of the manager holding the lock file
+func (o *DockerOrchestrator) GetLeader() (identity string, err error) {
+	elector := &fileLeaderElector{
+		path: o.config.LockFile,
+	}
+	return elector.leader()
+}
+
+// GetSharedState returns the state shared by the managers, stored in a file next to the lock file
+func (o *DockerOrchestrator) GetSharedState() (state map[string]string, err error) {
+	store := &fileStateStore{
+		path: o.config.LockFile + ".state",
+	}
+	return store.get()
+}
+
+// SaveSharedState saves an entry of the state shared by the managers
+func (o *DockerOrchestrator) SaveSharedState(key, value string) (err error) {
+	store := &fileStateStore{
+		path: o.config.LockFile + ".state",
+	}
+	return store.save(key, value)
+}
+
+// GetCredentials returns the repository credentials of the volume set in the credentials file
+// The file is read at each call so that credentials can be rotated without restarting the manager.
+func (o *DockerOrchestrator) GetCredentials(v *volume.Volume) (credentials map[string]string, err error) {
+	if o.config.CredentialsFile == "" {
+		return
+	}
+
+	var c dockerCredentials
+	_, err = toml.DecodeFile(o.config.CredentialsFile, &c)
+	if err != nil {
+		err = fmt.Errorf("failed to read credentials file: %s", err)
+		return
+	}
+
+	credentials = filterCredentials(c.Volumes[v.Name])
+	return
+}
+
 // GetVolumes returns the Docker volumes, inspected and filtered
 func (o *DockerOrchestrator) GetVolumes(volumeFilters volume.Filters) (volumes []*volume.Volume, err error) {
 
@@ -98,7 +163,7 @@ func (o *DockerOrchestrator) GetVolumes(volumeFilters volume.Filters) (volumes [
 }
 
 // DeployAgent creates a `bivac agent` container
-func (o *DockerOrchestrator) DeployAgent(image string, cmd []string, envs []string, v *volume.Volume) (success bool, output string, err error) {
+func (o *DockerOrchestrator) DeployAgent(ctx context.Context, image string, cmd []string, envs []string, v *volume.Volume) (success bool, output string, err error) {
 	success = false
 	err = o.PullImage(image)
 	if err != nil {
@@ -124,7 +189,7 @@ func (o *DockerOrchestrator) DeployAgent(image string, cmd []string, envs []stri
 	mounts = append(mounts, additionalVolumes...)
 
 	container, err := o.client.ContainerCreate(
-		context.Background(),
+		ctx,
 		&containertypes.Config{
 			Hostname:     createAgentName(),
 			Cmd:          cmd,
@@ -154,19 +219,9 @@ func (o *DockerOrchestrator) DeployAgent(image string, cmd []string, envs []stri
 		return
 	}
 
-	var exited bool
-
-	for !exited {
-		var cont types.ContainerJSON
-		cont, err = o.client.ContainerInspect(context.Background(), container.ID)
-		if err != nil {
-			err = fmt.Errorf("failed to inspect container: %s", err)
-			return
-		}
-
-		if cont.State.Status == "exited" {
-			exited = true
-		}
+	err = o.waitContainer(ctx, container.ID)
+	if err != nil {
+		return
 	}
 
 	body, err := o.client.ContainerLogs(context.Background(), container.ID, types.ContainerLogsOptions{
@@ -205,6 +260,30 @@ func (o *DockerOrchestrator) DeployAgent(image string, cmd []string, envs []stri
 	return
 }
 
+// waitContainer waits for a container to exit.
+// The container is left running if the context is done first.
+func (o *DockerOrchestrator) waitContainer(ctx context.Context, containerID string) (err error) {
+	for {
+		var cont types.ContainerJSON
+		cont, err = o.client.ContainerInspect(context.Background(), containerID)
+		if err != nil {
+			err = fmt.Errorf("failed to inspect container: %s", err)
+			return
+		}
+
+		if cont.State.Status == "exited" {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("agent interrupted: %s", ctx.Err())
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 // RemoveContainer removes a container based on its ID
 func (o *DockerOrchestrator) RemoveContainer(containerID string) (err error) {
 	err = o.client.ContainerRemove(context.Background(), containerID, types.ContainerRemoveOptions{
@@ -330,7 +409,7 @@ func (o *DockerOrchestrator) RetrieveOrphanAgents() (containers map[string]strin
 }
 
 // AttachOrphanAgent connects to a running agent and wait for the end of the backup proccess
-func (o *DockerOrchestrator) AttachOrphanAgent(containerID, namespace string) (success bool, output string, err error) {
+func (o *DockerOrchestrator) AttachOrphanAgent(ctx context.Context, containerID, namespace string) (success bool, output string, err error) {
 	container, err := o.client.ContainerInspect(context.Background(), containerID)
 	if err != nil {
 		err = fmt.Errorf("failed to inspect container: %s", err)
@@ -345,19 +424,9 @@ func (o *DockerOrchestrator) AttachOrphanAgent(containerID, namespace string) (s
 		return
 	}
 
-	var exited bool
-
-	for !exited {
-		var cont types.ContainerJSON
-		cont, err = o.client.ContainerInspect(context.Background(), container.ID)
-		if err != nil {
-			err = fmt.Errorf("failed to inspect container: %s", err)
-			return
-		}
-
-		if cont.State.Status == "exited" {
-			exited = true
-		}
+	err = o.waitContainer(ctx, container.ID)
+	if err != nil {
+		return
 	}
 
 	body, err := o.client.ContainerLogs(context.Background(), container.ID, types.ContainerLogsOptions{
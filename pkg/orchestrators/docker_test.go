@@ -248,7 +248,7 @@ func TestDockerDeployAgentSuccess(t *testing.T) {
 			Network: "",
 		},
 	}
-	success, _, err := o.DeployAgent(fakeImage, fakeCmd, fakeEnv, fakeVolume)
+	success, _, err := o.DeployAgent(context.Background(), fakeImage, fakeCmd, fakeEnv, fakeVolume)
 
 	assert.Nil(t, err)
 	assert.True(t, success)
@@ -313,6 +313,42 @@ func TestDockerPullImageFailToPull(t *testing.T) {
 	assert.Equal(t, err, fmt.Errorf("error"))
 }
 
+// GetCredentials
+func TestDockerGetCredentials(t *testing.T) {
+	f, err := ioutil.TempFile("", "bivac-credentials")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(`
+[volumes.foo]
+RESTIC_PASSWORD = "s3cr3t=="
+AWS_ACCESS_KEY_ID = "foo"
+LD_PRELOAD = "/tmp/foo.so"
+`)
+	assert.Nil(t, err)
+	f.Close()
+
+	o := &DockerOrchestrator{
+		config: &DockerConfig{
+			CredentialsFile: f.Name(),
+		},
+	}
+
+	credentials, err := o.GetCredentials(&volume.Volume{Name: "foo"})
+	assert.Nil(t, err)
+	assert.Equal(t, credentials, map[string]string{
+		"RESTIC_PASSWORD":   "s3cr3t==",
+		"AWS_ACCESS_KEY_ID": "foo",
+	})
+
+	credentials, err = o.GetCredentials(&volume.Volume{Name: "bar"})
+	assert.Nil(t, err)
+	assert.Nil(t, credentials)
+
+	o.config.CredentialsFile = f.Name() + ".missing"
+	_, err = o.GetCredentials(&volume.Volume{Name: "foo"})
+	assert.NotNil(t, err)
+}
+
 // backlistedVolume
 func TestDockerBlacklistedVolume(t *testing.T) {
 	testCases := []struct {
@@ -2,6 +2,7 @@ package orchestrators
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"sort"
@@ -9,9 +10,11 @@ import (
 	"time"
 	"unicode/utf8"
 
+	log "github.com/Sirupsen/logrus"
 	"github.com/camptocamp/bivac/pkg/volume"
 	"github.com/jinzhu/copier"
 	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -29,6 +32,9 @@ type KubernetesConfig struct {
 	AgentServiceAccount    string
 	AgentLabelsInline      string
 	AgentAnnotationsInline string
+	AgentStartTimeout      time.Duration
+	LeaseName              string
+	CredentialsSecret      string
 }
 
 // KubernetesOrchestrator implements a container orchestrator for Kubernetes
@@ -66,6 +72,50 @@ func (*KubernetesOrchestrator) GetPath(v *volume.Volume) string {
 	return v.Namespace
 }
 
+// RunLeaderElection campaigns for the leadership in background using a Lease object in the manager's namespace
+func (o *KubernetesOrchestrator) RunLeaderElection(ctx context.Context, identity string, onElected func(ctx context.Context)) (err error) {
+	if o.config.Namespace == "" {
+		err = fmt.Errorf("no namespace configured for the lease")
+		return
+	}
+	elector := &kubernetesLeaderElector{
+		client:    o.client,
+		namespace: o.config.Namespace,
+		name:      o.config.LeaseName,
+		identity:  identity,
+	}
+	go elector.run(ctx, onElected)
+	return
+}
+
+// GetLeader returns the identity of the manager holding the Lease
+func (o *KubernetesOrchestrator) GetLeader() (identity string, err error) {
+	elector := &kubernetesLeaderElector{
+		client:    o.client,
+		namespace: o.config.Namespace,
+		name:      o.config.LeaseName,
+	}
+	return elector.leader()
+}
+
+// GetSharedState returns the state shared by the managers, stored in a ConfigMap next to the Lease
+func (o *KubernetesOrchestrator) GetSharedState() (state map[string]string, err error) {
+	return o.getStateStore().get()
+}
+
+// SaveSharedState saves an entry of the state shared by the managers
+func (o *KubernetesOrchestrator) SaveSharedState(key, value string) (err error) {
+	return o.getStateStore().save(key, value)
+}
+
+func (o *KubernetesOrchestrator) getStateStore() *kubernetesStateStore {
+	return &kubernetesStateStore{
+		client:    o.client,
+		namespace: o.config.Namespace,
+		name:      o.config.LeaseName + "-state",
+	}
+}
+
 // GetVolumes returns the Kubernetes persistent volume claims, inspected and filtered
 func (o *KubernetesOrchestrator) GetVolumes(volumeFilters volume.Filters) (volumes []*volume.Volume, err error) {
 	// Get namespaces
@@ -77,6 +127,15 @@ func (o *KubernetesOrchestrator) GetVolumes(volumeFilters volume.Filters) (volum
 			return nil, err
 		}
 
+		// Namespace annotations provide the default retention policy of the volumes of the namespace
+		var namespaceAnnotations map[string]string
+		ns, err := o.client.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+		if err != nil {
+			log.Warningf("failed to retrieve annotations of namespace %s: %s", namespace, err)
+		} else {
+			namespaceAnnotations = ns.Annotations
+		}
+
 		for _, pvc := range pvcs.Items {
 
 			if backupString, ok := pvc.Annotations["bivac.backup"]; ok {
@@ -91,13 +150,16 @@ func (o *KubernetesOrchestrator) GetVolumes(volumeFilters volume.Filters) (volum
 				}
 			}
 			v := &volume.Volume{
-				ID:        string(pvc.UID),
-				Name:      pvc.Name,
-				Namespace: namespace,
-				Logs:      make(map[string]string),
-				Labels:    pvc.Labels,
-				RepoName:  pvc.Name,
-				SubPath:   "",
+				ID:          string(pvc.UID),
+				Name:        pvc.Name,
+				Namespace:   namespace,
+				Logs:        make(map[string]string),
+				Labels:      pvc.Labels,
+				Annotations: pvc.Annotations,
+				RepoName:    pvc.Name,
+				SubPath:     "",
+
+				NamespaceAnnotations: namespaceAnnotations,
 			}
 
 			containers, _ := o.GetContainersMountingVolume(v)
@@ -127,16 +189,83 @@ func (o *KubernetesOrchestrator) GetVolumes(volumeFilters volume.Filters) (volum
 	return
 }
 
+// GetCredentials returns the repository credentials stored in a secret of the volume's namespace
+func (o *KubernetesOrchestrator) GetCredentials(v *volume.Volume) (credentials map[string]string, err error) {
+	secret, err := o.getCredentialsSecret(v)
+	if err != nil || secret == nil {
+		return
+	}
+	credentials = getSecretCredentials(secret)
+	return
+}
+
+// getCredentialsSecret returns the secret storing the repository credentials of the volume, if any
+// The secret is named by the bivac.credentials-secret option of the volume,
+// or by the global credentials secret which is optional in each namespace.
+func (o *KubernetesOrchestrator) getCredentialsSecret(v *volume.Volume) (secret *apiv1.Secret, err error) {
+	name, explicit := v.GetOption("bivac.credentials-secret")
+	if !explicit {
+		name = o.config.CredentialsSecret
+	}
+	if name == "" {
+		return
+	}
+
+	secret, err = o.client.CoreV1().Secrets(v.Namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		secret = nil
+		if !explicit && apierrors.IsNotFound(err) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("failed to get secret %s/%s: %s", v.Namespace, name, err)
+	}
+	return
+}
+
+func getSecretCredentials(secret *apiv1.Secret) map[string]string {
+	raw := make(map[string]string)
+	for key, value := range secret.Data {
+		raw[key] = string(value)
+	}
+	return filterCredentials(raw)
+}
+
 // DeployAgent creates a `bivac agent` container
-func (o *KubernetesOrchestrator) DeployAgent(image string, cmd, envs []string, v *volume.Volume) (success bool, output string, err error) {
+func (o *KubernetesOrchestrator) DeployAgent(ctx context.Context, image string, cmd, envs []string, v *volume.Volume) (success bool, output string, err error) {
 	success = false
 	kvs := []apiv1.Volume{}
 	kvms := []apiv1.VolumeMount{}
 	var node string
 
+	// The agent reads the credentials of the volume from its secret so that they do not appear in the pod spec
+	secret, err := o.getCredentialsSecret(v)
+	if err != nil {
+		err = fmt.Errorf("failed to get repository credentials: %s", err)
+		return
+	}
+	var credentials map[string]string
+	if secret != nil {
+		credentials = getSecretCredentials(secret)
+	}
+
 	var environment []apiv1.EnvVar
 	for _, env := range envs {
-		splitted := strings.Split(env, "=")
+		splitted := strings.SplitN(env, "=", 2)
+		if _, ok := credentials[splitted[0]]; ok {
+			environment = append(environment, apiv1.EnvVar{
+				Name: splitted[0],
+				ValueFrom: &apiv1.EnvVarSource{
+					SecretKeyRef: &apiv1.SecretKeySelector{
+						LocalObjectReference: apiv1.LocalObjectReference{
+							Name: secret.Name,
+						},
+						Key: splitted[0],
+					},
+				},
+			})
+			continue
+		}
 		environment = append(environment, apiv1.EnvVar{
 			Name:  splitted[0],
 			Value: splitted[1],
@@ -249,30 +378,9 @@ func (o *KubernetesOrchestrator) DeployAgent(image string, cmd, envs []string, v
 	agentName := pod.ObjectMeta.Name
 	defer o.DeletePod(agentName, v.Namespace)
 
-	timeout := time.After(60 * 5 * time.Second)
-	terminated := false
-	for !terminated {
-		pod, err := o.client.CoreV1().Pods(v.Namespace).Get(agentName, metav1.GetOptions{})
-		if err != nil {
-			err = fmt.Errorf("failed to get pod: %s", err)
-			return false, "", err
-		}
-
-		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
-			if len(pod.Status.ContainerStatuses) == 0 {
-				return false, "", fmt.Errorf("no container found")
-			}
-			success = true
-			terminated = true
-		} else if pod.Status.Phase != apiv1.PodRunning {
-			select {
-			case <-timeout:
-				err = fmt.Errorf("failed to start agent: timeout")
-				return false, "", err
-			default:
-				continue
-			}
-		}
+	success, err = o.waitPod(ctx, agentName, v.Namespace, o.config.AgentStartTimeout)
+	if err != nil {
+		return false, "", err
 	}
 
 	req := o.client.CoreV1().Pods(v.Namespace).GetLogs(agentName, &apiv1.PodLogOptions{})
@@ -293,6 +401,43 @@ func (o *KubernetesOrchestrator) DeployAgent(image string, cmd, envs []string, v
 	return
 }
 
+// waitPod waits for the termination of a pod.
+// An error is returned if the pod doesn't start before startTimeout or if the context is done first.
+func (o *KubernetesOrchestrator) waitPod(ctx context.Context, name, namespace string, startTimeout time.Duration) (success bool, err error) {
+	if startTimeout <= 0 {
+		startTimeout = 5 * time.Minute
+	}
+	timeout := time.After(startTimeout)
+	for {
+		pod, err := o.client.CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			err = fmt.Errorf("failed to get pod: %s", err)
+			return false, err
+		}
+
+		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			if len(pod.Status.ContainerStatuses) == 0 {
+				return false, fmt.Errorf("no container found")
+			}
+			return true, nil
+		}
+
+		// The start timeout doesn't apply once the agent is running
+		startTimeout := timeout
+		if pod.Status.Phase == apiv1.PodRunning {
+			startTimeout = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, fmt.Errorf("agent interrupted: %s", ctx.Err())
+		case <-startTimeout:
+			return false, fmt.Errorf("failed to start agent: timeout")
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 // DeletePod removes pod based on its name
 func (o *KubernetesOrchestrator) DeletePod(name, namespace string) {
 	err := o.client.CoreV1().Pods(namespace).Delete(name, &metav1.DeleteOptions{})
@@ -435,7 +580,7 @@ func (o *KubernetesOrchestrator) RetrieveOrphanAgents() (containers map[string]s
 }
 
 // AttachOrphanAgent connects to a running agent and wait for the end of the backup proccess
-func (o *KubernetesOrchestrator) AttachOrphanAgent(containerID, namespace string) (success bool, output string, err error) {
+func (o *KubernetesOrchestrator) AttachOrphanAgent(ctx context.Context, containerID, namespace string) (success bool, output string, err error) {
 	_, err = o.client.CoreV1().Pods(namespace).Get(containerID, metav1.GetOptions{})
 	if err != nil {
 		err = fmt.Errorf("failed to get pod: %s", err)
@@ -443,30 +588,9 @@ func (o *KubernetesOrchestrator) AttachOrphanAgent(containerID, namespace string
 	}
 	defer o.DeletePod(containerID, namespace)
 
-	timeout := time.After(60 * time.Second)
-	terminated := false
-	for !terminated {
-		pod, err := o.client.CoreV1().Pods(namespace).Get(containerID, metav1.GetOptions{})
-		if err != nil {
-			err = fmt.Errorf("failed to get pod: %s", err)
-			return false, "", err
-		}
-
-		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
-			if len(pod.Status.ContainerStatuses) == 0 {
-				return false, "", fmt.Errorf("no container found")
-			}
-			success = true
-			terminated = true
-		} else if pod.Status.Phase != apiv1.PodRunning {
-			select {
-			case <-timeout:
-				err = fmt.Errorf("failed to start agent: timeout")
-				return false, "", err
-			default:
-				continue
-			}
-		}
+	success, err = o.waitPod(ctx, containerID, namespace, o.config.AgentStartTimeout)
+	if err != nil {
+		return false, "", err
 	}
 
 	req := o.client.CoreV1().Pods(namespace).GetLogs(containerID, &apiv1.PodLogOptions{})
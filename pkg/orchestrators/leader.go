@@ -0,0 +1,257 @@
+package orchestrators
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// kubernetesLeaderElector relies on a Lease object
+type kubernetesLeaderElector struct {
+	client    *kubernetes.Clientset
+	namespace string
+	name      string
+	identity  string
+}
+
+// run campaigns for the leadership until ctx is done.
+// onElected is called in a new goroutine each time the manager becomes the leader,
+// with a context which is cancelled when the leadership is lost.
+func (e *kubernetesLeaderElector) run(ctx context.Context, onElected func(ctx context.Context)) {
+	le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Namespace: e.namespace,
+				Name:      e.name,
+			},
+			Client: e.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{
+				Identity: e.identity,
+			},
+		},
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: onElected,
+			OnStoppedLeading: func() {},
+		},
+		Name: e.name,
+	})
+	if err != nil {
+		log.Errorf("failed to create leader elector: %s", err)
+		return
+	}
+
+	// The elector returns each time the leadership is lost
+	for ctx.Err() == nil {
+		le.Run(ctx)
+	}
+}
+
+// leader returns the identity of the current leader
+func (e *kubernetesLeaderElector) leader() (identity string, err error) {
+	lease, err := e.client.CoordinationV1().Leases(e.namespace).Get(e.name, metav1.GetOptions{})
+	if err != nil {
+		err = fmt.Errorf("failed to get lease: %s", err)
+		return
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity == "" {
+		err = fmt.Errorf("no leader elected")
+		return
+	}
+	identity = *lease.Spec.HolderIdentity
+	return
+}
+
+// fileLeaderElector relies on a lease stored in a file shared by the managers.
+// The file contains the identity of the leader and the date of its last renewal.
+// Its updates are serialized with an exclusive lock on a sibling file.
+type fileLeaderElector struct {
+	path     string
+	identity string
+}
+
+func (e *fileLeaderElector) run(ctx context.Context, onElected func(ctx context.Context)) {
+	for {
+		ok, err := e.tryAcquireOrRenew()
+		if err != nil {
+			log.Errorf("failed to acquire leader lock: %s", err)
+		}
+		if ok {
+			e.lead(ctx, onElected)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(retryPeriod):
+		}
+	}
+}
+
+// lead renews the lease until it is lost or ctx is done
+func (e *fileLeaderElector) lead(ctx context.Context, onElected func(ctx context.Context)) {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go onElected(leaderCtx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.release()
+			return
+		case <-time.After(retryPeriod):
+		}
+
+		ok, err := e.tryAcquireOrRenew()
+		if err != nil {
+			log.Errorf("failed to renew leader lock: %s", err)
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// tryAcquireOrRenew takes the lease if it is free, expired or already held
+func (e *fileLeaderElector) tryAcquireOrRenew() (ok bool, err error) {
+	unlock, err := e.lock()
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	holder, renewDate, err := e.read()
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err == nil && holder != e.identity && time.Since(renewDate) < leaseDuration {
+		return false, nil
+	}
+
+	err = e.write()
+	if err != nil {
+		return
+	}
+	return true, nil
+}
+
+// lock prevents the other managers from updating the lease until unlock is called
+func (e *fileLeaderElector) lock() (unlock func(), err error) {
+	return lockFile(e.path)
+}
+
+// lockFile takes an exclusive lock on a sibling file of path until unlock is called
+func lockFile(path string) (unlock func(), err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		err = fmt.Errorf("failed to create lock directory: %s", err)
+		return
+	}
+
+	f, err := os.OpenFile(path+".flock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		err = fmt.Errorf("failed to open lock file: %s", err)
+		return
+	}
+
+	err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		f.Close()
+		err = fmt.Errorf("failed to lock lock file: %s", err)
+		return
+	}
+
+	unlock = func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}
+	return
+}
+
+func (e *fileLeaderElector) read() (holder string, renewDate time.Time, err error) {
+	data, err := ioutil.ReadFile(e.path)
+	if err != nil {
+		return
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		err = fmt.Errorf("invalid lock file content: `%s'", string(data))
+		return
+	}
+	holder = fields[0]
+	timestamp, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		err = fmt.Errorf("invalid lock file date: %s", err)
+		return
+	}
+	renewDate = time.Unix(timestamp, 0)
+	return
+}
+
+func (e *fileLeaderElector) write() (err error) {
+	tmp := fmt.Sprintf("%s.%s", e.path, e.identity)
+	err = ioutil.WriteFile(tmp, []byte(fmt.Sprintf("%s %d\n", e.identity, time.Now().Unix())), 0644)
+	if err != nil {
+		err = fmt.Errorf("failed to write lock file: %s", err)
+		return
+	}
+
+	err = os.Rename(tmp, e.path)
+	if err != nil {
+		err = fmt.Errorf("failed to write lock file: %s", err)
+	}
+	return
+}
+
+// leader returns the identity of the current leader
+func (e *fileLeaderElector) leader() (identity string, err error) {
+	holder, renewDate, err := e.read()
+	if err != nil {
+		err = fmt.Errorf("failed to read lock file: %s", err)
+		return
+	}
+	if time.Since(renewDate) >= leaseDuration {
+		err = fmt.Errorf("no leader elected")
+		return
+	}
+	identity = holder
+	return
+}
+
+// release frees the lease so that another manager can take it without waiting for its expiration
+func (e *fileLeaderElector) release() {
+	unlock, err := e.lock()
+	if err != nil {
+		log.Errorf("failed to release leader lock: %s", err)
+		return
+	}
+	defer unlock()
+
+	holder, _, err := e.read()
+	if err != nil || holder != e.identity {
+		return
+	}
+	os.Remove(e.path)
+}
@@ -0,0 +1,81 @@
+package orchestrators
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fileLeaderElector
+func TestFileLeaderElector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manager.lock")
+
+	foo := &fileLeaderElector{path: path, identity: "foo"}
+	bar := &fileLeaderElector{path: path, identity: "bar"}
+
+	ok, err := foo.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	ok, err = bar.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	ok, err = foo.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// bar takes over once foo released the lease
+	foo.release()
+	ok, err = bar.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// An expired lease can be taken
+	err = ioutil.WriteFile(path, []byte("bar 0\n"), 0644)
+	assert.Nil(t, err)
+	ok, err = foo.tryAcquireOrRenew()
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
+
+func TestFileLeaderElectorConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manager.lock")
+
+	// Only one of the electors campaigning at the same time gets the lease
+	for i := 0; i < 50; i++ {
+		os.Remove(path)
+
+		var wg sync.WaitGroup
+		start := make(chan bool)
+		leaders := make(chan string, 10)
+		for j := 0; j < 10; j++ {
+			wg.Add(1)
+			go func(e *fileLeaderElector) {
+				defer wg.Done()
+				<-start
+				ok, err := e.tryAcquireOrRenew()
+				assert.Nil(t, err)
+				if ok {
+					leaders <- e.identity
+				}
+			}(&fileLeaderElector{path: path, identity: fmt.Sprintf("manager%d-%d", i, j)})
+		}
+		close(start)
+		wg.Wait()
+		close(leaders)
+
+		assert.Equal(t, len(leaders), 1)
+	}
+}
@@ -1,6 +1,8 @@
 package orchestrators
 
 import (
+	"context"
+
 	"github.com/camptocamp/bivac/pkg/volume"
 )
 
@@ -9,10 +11,15 @@ type Orchestrator interface {
 	GetName() string
 	GetPath(v *volume.Volume) string
 	GetVolumes(volumeFilters volume.Filters) (volumes []*volume.Volume, err error)
-	DeployAgent(image string, cmd []string, envs []string, volume *volume.Volume) (success bool, output string, err error)
+	DeployAgent(ctx context.Context, image string, cmd []string, envs []string, volume *volume.Volume) (success bool, output string, err error)
 	GetContainersMountingVolume(v *volume.Volume) (mountedVolumes []*volume.MountedVolume, err error)
 	ContainerExec(mountedVolumes *volume.MountedVolume, command []string) (stdout string, err error)
 	IsNodeAvailable(hostID string) (ok bool, err error)
 	RetrieveOrphanAgents() (containers map[string]string, err error)
-	AttachOrphanAgent(containerID, namespace string) (success bool, output string, err error)
+	AttachOrphanAgent(ctx context.Context, containerID, namespace string) (success bool, output string, err error)
+	RunLeaderElection(ctx context.Context, identity string, onElected func(ctx context.Context)) (err error)
+	GetLeader() (identity string, err error)
+	GetSharedState() (state map[string]string, err error)
+	SaveSharedState(key, value string) (err error)
+	GetCredentials(v *volume.Volume) (credentials map[string]string, err error)
 }
@@ -0,0 +1,124 @@
+package orchestrators
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// kubernetesStateStore keeps the state shared by the managers in a ConfigMap
+type kubernetesStateStore struct {
+	client    *kubernetes.Clientset
+	namespace string
+	name      string
+}
+
+func (s *kubernetesStateStore) get() (state map[string]string, err error) {
+	cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("failed to get config map %s/%s: %s", s.namespace, s.name, err)
+		return
+	}
+	state = cm.Data
+	return
+}
+
+func (s *kubernetesStateStore) save(key, value string) (err error) {
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := s.client.CoreV1().ConfigMaps(s.namespace).Get(s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = s.client.CoreV1().ConfigMaps(s.namespace).Create(&apiv1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: s.name,
+				},
+				Data: map[string]string{key: value},
+			})
+			return err
+		}
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[key] = value
+		_, err = s.client.CoreV1().ConfigMaps(s.namespace).Update(cm)
+		return err
+	})
+	if err != nil {
+		err = fmt.Errorf("failed to update config map %s/%s: %s", s.namespace, s.name, err)
+	}
+	return
+}
+
+// fileStateStore keeps the state shared by the managers in a JSON file
+// Its updates are serialized with an exclusive lock on a sibling file.
+type fileStateStore struct {
+	path string
+}
+
+func (s *fileStateStore) get() (state map[string]string, err error) {
+	data, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("failed to read state file: %s", err)
+		return
+	}
+
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		err = fmt.Errorf("failed to parse state file: %s", err)
+	}
+	return
+}
+
+func (s *fileStateStore) save(key, value string) (err error) {
+	unlock, err := lockFile(s.path)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	state, err := s.get()
+	if err != nil {
+		return
+	}
+	if state == nil {
+		state = make(map[string]string)
+	}
+	state[key] = value
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		err = fmt.Errorf("failed to marshal state: %s", err)
+		return
+	}
+
+	// The file is replaced so that it is never read while partially written
+	tmp := s.path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		err = fmt.Errorf("failed to write state file: %s", err)
+		return
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		err = fmt.Errorf("failed to write state file: %s", err)
+	}
+	return
+}
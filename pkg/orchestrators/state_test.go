@@ -0,0 +1,33 @@
+package orchestrators
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fileStateStore
+func TestFileStateStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bivac")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s := &fileStateStore{path: filepath.Join(dir, "manager.lock.state")}
+	state, err := s.get()
+	assert.Nil(t, err)
+	assert.Nil(t, state)
+
+	assert.Nil(t, s.save("foo", "bar"))
+	assert.Nil(t, s.save("fake", "baz"))
+	assert.Nil(t, s.save("foo", "qux"))
+
+	state, err = s.get()
+	assert.Nil(t, err)
+	assert.Equal(t, state, map[string]string{
+		"foo":  "qux",
+		"fake": "baz",
+	})
+}
@@ -0,0 +1,31 @@
+package volume
+
+import (
+	"time"
+)
+
+// Statuses of a job
+const (
+	JobPending   = "Pending"
+	JobRunning   = "Running"
+	JobSuccess   = "Success"
+	JobFailed    = "Failed"
+	JobCancelled = "Cancelled"
+)
+
+// Job is an asynchronous backup or restore request
+type Job struct {
+	ID           string
+	Type         string
+	VolumeID     string
+	Status       string
+	Error        string
+	CreationDate time.Time
+	StartDate    time.Time
+	EndDate      time.Time
+}
+
+// IsDone returns true if the job is over
+func (j *Job) IsDone() bool {
+	return j.Status == JobSuccess || j.Status == JobFailed || j.Status == JobCancelled
+}
@@ -0,0 +1,16 @@
+package volume
+
+import (
+	"time"
+)
+
+// QueueEntry describes a volume waiting for a backup slot
+type QueueEntry struct {
+	VolumeID    string
+	VolumeName  string
+	Hostname    string
+	Priority    int
+	DueDate     time.Time
+	EnqueueDate time.Time
+	Wait        time.Duration
+}
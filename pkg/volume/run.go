@@ -0,0 +1,43 @@
+package volume
+
+import (
+	"time"
+)
+
+// Triggers of a run
+const (
+	TriggerScheduled = "scheduled"
+	TriggerManual    = "manual"
+	TriggerOrphan    = "orphan"
+)
+
+// Run stores informations about one backup or restore execution on a volume
+type Run struct {
+	ID          string
+	VolumeID    string
+	VolumeName  string
+	Type        string
+	Trigger     string
+	Status      string
+	StartDate   time.Time
+	EndDate     time.Time
+	Duration    time.Duration
+	ExitCodes   map[string]int
+	SnapshotID  string
+	Stats       *BackupStats
+	Error       string
+	FailureKind string
+	// Warnings are the failures which did not fail the run, e.g. of the provider commands
+	Warnings []string
+}
+
+// BackupStats is the summary of a backup reported by the backup engine
+type BackupStats struct {
+	SnapshotID          string
+	FilesNew            int
+	FilesChanged        int
+	FilesUnmodified     int
+	DataAdded           int64
+	TotalBytesProcessed int64
+	Duration            time.Duration
+}
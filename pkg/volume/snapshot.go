@@ -0,0 +1,70 @@
+package volume
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Keys of the tags set on the snapshots, formatted as `key=value`
+const (
+	TagVolumeID     = "volume_id"
+	TagVolumeName   = "volume_name"
+	TagNamespace    = "namespace"
+	TagProvider     = "provider"
+	TagTrigger      = "trigger"
+	TagBivacVersion = "bivac_version"
+)
+
+// Snapshot is a backup of a volume stored in its repository
+type Snapshot struct {
+	ID       string    `json:"id"`
+	ShortID  string    `json:"short_id"`
+	Time     time.Time `json:"time"`
+	Hostname string    `json:"hostname"`
+	Paths    []string  `json:"paths"`
+	Tags     []string  `json:"tags"`
+}
+
+// FormatTag returns the tag `key=value`
+// Commas are replaced as they separate the tags in restic options.
+func FormatTag(key, value string) string {
+	return key + "=" + strings.Replace(value, ",", "_", -1)
+}
+
+// HasTags returns true if the snapshot has all the given tags
+func (s Snapshot) HasTags(tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, t := range s.Tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// GetTag returns the value of the tag key of the snapshot
+func (s Snapshot) GetTag(key string) (value string, ok bool) {
+	for _, t := range s.Tags {
+		if strings.HasPrefix(t, key+"=") {
+			return strings.TrimPrefix(t, key+"="), true
+		}
+	}
+	return
+}
+
+// Node is a file of a snapshot
+type Node struct {
+	Name    string      `json:"name"`
+	Type    string      `json:"type"`
+	Path    string      `json:"path"`
+	Size    uint64      `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+}
@@ -0,0 +1,31 @@
+package volume
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// FormatTag
+func TestFormatTag(t *testing.T) {
+	assert.Equal(t, FormatTag(TagVolumeName, "foo"), "volume_name=foo")
+	assert.Equal(t, FormatTag(TagVolumeName, "foo,bar"), "volume_name=foo_bar")
+}
+
+// HasTags / GetTag
+func TestSnapshotTags(t *testing.T) {
+	s := Snapshot{
+		Tags: []string{"volume_name=foo", "trigger=manual"},
+	}
+
+	assert.True(t, s.HasTags(nil))
+	assert.True(t, s.HasTags([]string{"trigger=manual"}))
+	assert.True(t, s.HasTags([]string{"trigger=manual", "volume_name=foo"}))
+	assert.False(t, s.HasTags([]string{"trigger=manual", "volume_name=bar"}))
+
+	value, ok := s.GetTag(TagTrigger)
+	assert.True(t, ok)
+	assert.Equal(t, value, "manual")
+	_, ok = s.GetTag(TagProvider)
+	assert.False(t, ok)
+}
@@ -1,6 +1,7 @@
 package volume
 
 import (
+	"strconv"
 	"sync"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -9,24 +10,46 @@ import (
 
 // Volume provides backup methods for a single volume
 type Volume struct {
-	ID         string
-	Name       string
-	BackupDir  string
-	Mount      string
-	Mountpoint string
-	Driver     string
-	Labels     map[string]string
-	ReadOnly   bool
-	HostBind   string
-	Hostname   string
-	Namespace  string
-	RepoName   string
-	SubPath    string
+	ID          string
+	Name        string
+	BackupDir   string
+	Mount       string
+	Mountpoint  string
+	Driver      string
+	Labels      map[string]string
+	Annotations map[string]string
+	ReadOnly    bool
+	HostBind    string
+	Hostname    string
+	Namespace   string
+	RepoName    string
+	SubPath     string
+
+	NamespaceAnnotations map[string]string
 
 	BackingUp           bool
 	LastBackupDate      string
 	LastBackupStatus    string
 	LastBackupStartDate string
+	LastFailureKind     string
+	ConsecutiveFailures int
+	LastBackupStats     *BackupStats
+	NextBackupDate      string
+	LastCheckDate       string
+	LastCheckStatus     string
+	NextCheckDate       string
+	LastPruneDate       string
+	LastPruneStatus     string
+	NextPruneDate       string
+	MaintenanceTask     string
+	Schedule            string
+	Priority            int
+	BackupTimeout       string
+	BackupWindow        string
+	Blackout            string
+	Retention           *RetentionPolicy
+	Excludes            []string
+	Includes            []string
 	Logs                map[string]string
 
 	Metrics *Metrics `json:"-"`
@@ -34,6 +57,41 @@ type Volume struct {
 	Mux sync.Mutex
 }
 
+// Sources of a retention policy
+const (
+	RetentionSourceGlobal = "global"
+	RetentionSourceVolume = "volume"
+)
+
+// RetentionPolicy is the number of snapshots kept when old snapshots of a volume are forgotten
+type RetentionPolicy struct {
+	Source  string
+	Last    int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+}
+
+// Args returns the `restic forget` options of the policy
+func (p RetentionPolicy) Args() (args []string) {
+	for _, o := range []struct {
+		name  string
+		value int
+	}{
+		{"--keep-last", p.Last},
+		{"--keep-daily", p.Daily},
+		{"--keep-weekly", p.Weekly},
+		{"--keep-monthly", p.Monthly},
+		{"--keep-yearly", p.Yearly},
+	} {
+		if o.value > 0 {
+			args = append(args, o.name, strconv.Itoa(o.value))
+		}
+	}
+	return
+}
+
 // Filters contains the volumes filters
 type Filters struct {
 	Blacklist           []string
@@ -44,12 +102,23 @@ type Filters struct {
 // Metrics are used to fill the Prometheus endpoint
 // TODO: Merge LastBackupDate and LastBackupStatus
 type Metrics struct {
-	LastBackupDate   prometheus.Gauge
-	LastBackupStatus prometheus.Gauge
-	OldestBackupDate prometheus.Gauge
-	BackupCount      prometheus.Gauge
+	LastBackupDate          prometheus.Gauge
+	LastBackupStatus        prometheus.Gauge
+	OldestBackupDate        prometheus.Gauge
+	BackupCount             prometheus.Gauge
+	BackupTimeouts          prometheus.Counter
+	BackupDuration          *prometheus.HistogramVec
+	RestoreDuration         *prometheus.HistogramVec
+	LastBackupBytesAdded    prometheus.Gauge
+	RepositorySize          prometheus.Gauge
+	BackupRetries           prometheus.Counter
+	AgentDeploymentFailures prometheus.Counter
+	LastCheckStatus         prometheus.Gauge
 }
 
+// durationBuckets are the buckets of the backup and restore duration histograms, from 10s to about 11h
+var durationBuckets = prometheus.ExponentialBuckets(10, 2, 13)
+
 // MountedVolume stores mounted volumes inside a container
 type MountedVolume struct {
 	PodID       string
@@ -59,6 +128,26 @@ type MountedVolume struct {
 	Path        string
 }
 
+// GetOption returns the value of a Bivac option (e.g. `bivac.schedule`) set on the volume.
+// Annotations take precedence over labels.
+func (v *Volume) GetOption(key string) (value string, ok bool) {
+	if value, ok = v.Annotations[key]; ok {
+		return
+	}
+	value, ok = v.Labels[key]
+	return
+}
+
+// GetRetentionOption returns the value of a retention option (e.g. `bivac.keep-daily`) set on the volume.
+// Unlike other options, retention options may also be set on the namespace of the volume.
+func (v *Volume) GetRetentionOption(key string) (value string, ok bool) {
+	if value, ok = v.GetOption(key); ok {
+		return
+	}
+	value, ok = v.NamespaceAnnotations[key]
+	return
+}
+
 // SetupMetrics initializes the volume's metrics
 func (v *Volume) SetupMetrics() {
 	v.Metrics = &Metrics{}
@@ -103,6 +192,89 @@ func (v *Volume) SetupMetrics() {
 			"hostname":    v.Hostname,
 		},
 	})
+	v.Metrics.BackupTimeouts = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bivac_backupTimeouts",
+		Help: "Count of backups interrupted because they exceeded their timeout",
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	})
+	v.Metrics.BackupDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bivac_backupDuration",
+		Help:    "Duration of the backups in seconds, by status of the run",
+		Buckets: durationBuckets,
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	}, []string{"status"})
+	v.Metrics.RestoreDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "bivac_restoreDuration",
+		Help:    "Duration of the restores in seconds, by status of the run",
+		Buckets: durationBuckets,
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	}, []string{"status"})
+	v.Metrics.LastBackupBytesAdded = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bivac_lastBackupBytesAdded",
+		Help: "Bytes added to the repository by the last backup",
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	})
+	v.Metrics.RepositorySize = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bivac_repositorySize",
+		Help: "Size of the repository in bytes",
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	})
+	v.Metrics.BackupRetries = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bivac_backupRetries",
+		Help: "Count of backups retried after a transient failure",
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	})
+	v.Metrics.AgentDeploymentFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bivac_agentDeploymentFailures",
+		Help: "Count of agents which could not be deployed",
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	})
+	v.Metrics.LastCheckStatus = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bivac_lastCheckStatus",
+		Help: "Status of the last repository check, -1 if the repository has never been checked",
+		ConstLabels: map[string]string{
+			"volume_id":   v.ID,
+			"volume_name": v.Name,
+			"hostbind":    v.HostBind,
+			"hostname":    v.Hostname,
+		},
+	})
+	v.Metrics.LastCheckStatus.Set(-1)
 
 	return
 }
@@ -113,5 +285,13 @@ func (v *Volume) CleanupMetrics() {
 	prometheus.Unregister(v.Metrics.LastBackupStatus)
 	prometheus.Unregister(v.Metrics.OldestBackupDate)
 	prometheus.Unregister(v.Metrics.BackupCount)
+	prometheus.Unregister(v.Metrics.BackupTimeouts)
+	prometheus.Unregister(v.Metrics.BackupDuration)
+	prometheus.Unregister(v.Metrics.RestoreDuration)
+	prometheus.Unregister(v.Metrics.LastBackupBytesAdded)
+	prometheus.Unregister(v.Metrics.RepositorySize)
+	prometheus.Unregister(v.Metrics.BackupRetries)
+	prometheus.Unregister(v.Metrics.AgentDeploymentFailures)
+	prometheus.Unregister(v.Metrics.LastCheckStatus)
 	return
 }
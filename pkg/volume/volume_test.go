@@ -25,3 +25,61 @@ func TestSetupMetrics(t *testing.T) {
 	v.SetupMetrics()
 	assert.Equal(t, v.ID, "bar")
 }
+
+// GetOption
+func TestGetOption(t *testing.T) {
+	v := Volume{
+		Labels: map[string]string{
+			"bivac.schedule": "0 0 * * *",
+			"bivac.foo":      "bar",
+		},
+		Annotations: map[string]string{
+			"bivac.schedule": "0 */4 * * *",
+		},
+	}
+
+	value, ok := v.GetOption("bivac.schedule")
+	assert.True(t, ok)
+	assert.Equal(t, value, "0 */4 * * *")
+	value, ok = v.GetOption("bivac.foo")
+	assert.True(t, ok)
+	assert.Equal(t, value, "bar")
+	_, ok = v.GetOption("bivac.bar")
+	assert.False(t, ok)
+}
+
+func TestGetRetentionOption(t *testing.T) {
+	v := Volume{
+		Labels: map[string]string{
+			"bivac.keep-daily": "7",
+		},
+		NamespaceAnnotations: map[string]string{
+			"bivac.keep-daily":  "30",
+			"bivac.keep-weekly": "4",
+			"bivac.schedule":    "0 0 * * *",
+		},
+	}
+
+	value, ok := v.GetRetentionOption("bivac.keep-daily")
+	assert.True(t, ok)
+	assert.Equal(t, value, "7")
+	value, ok = v.GetRetentionOption("bivac.keep-weekly")
+	assert.True(t, ok)
+	assert.Equal(t, value, "4")
+
+	// Namespace annotations only set retention options
+	_, ok = v.GetOption("bivac.keep-weekly")
+	assert.False(t, ok)
+	_, ok = v.GetOption("bivac.schedule")
+	assert.False(t, ok)
+}
+
+// RetentionPolicy
+func TestRetentionPolicyArgs(t *testing.T) {
+	p := RetentionPolicy{
+		Last:  3,
+		Daily: 7,
+	}
+	assert.Equal(t, p.Args(), []string{"--keep-last", "3", "--keep-daily", "7"})
+	assert.Nil(t, RetentionPolicy{}.Args())
+}